@@ -0,0 +1,279 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/ganto/pkgproxy/pkg/cache"
+	"github.com/ganto/pkgproxy/pkg/pkgproxy"
+	"github.com/ganto/pkgproxy/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+const defaultTempFileAge = "1h"
+
+var (
+	dryRun           bool
+	purgeOlderThan   string
+	tmpFileOlderThan string
+
+	// Configured cache storage backend, nil for the local cache directory
+	cacheStorage cache.Storage
+)
+
+func newCacheCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "cache",
+		Short: "Inspect and maintain the local cache directory",
+		Long: `Inspect and maintain the local cache directory without a running
+pkgproxy. The commands operate directly on --cachedir, or the configured
+storage backend, using the repositories from the configuration file.`,
+		Args: cobra.NoArgs,
+		PersistentPreRunE: func(_ *cobra.Command, _ []string) error {
+			return initStorage()
+		},
+	}
+	c.AddCommand(newCacheLsCommand())
+	c.AddCommand(newCacheDuCommand())
+	c.AddCommand(newCachePurgeCommand())
+	c.AddCommand(newCachePruneCommand())
+	c.AddCommand(newCacheCleanTmpCommand())
+
+	return c
+}
+
+func newCacheLsCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "ls <repository> [prefix]",
+		Short: "List cached files of a repository",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := lookupRepository(args[0])
+			if err != nil {
+				return err
+			}
+			prefix := ""
+			if len(args) > 1 {
+				prefix = args[1]
+			}
+			entries, err := newRepositoryCache(repo).List(path.Join("/", args[0], prefix))
+			if err != nil {
+				return err
+			}
+			for _, entry := range entries {
+				fmt.Fprintf(cmd.OutOrStdout(), "%10s  %s  %s\n",
+					utils.FormatByteSize(entry.Size), entry.ModTime.Format(time.DateTime), entry.URI)
+			}
+			return nil
+		},
+	}
+}
+
+func newCacheDuCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "du",
+		Short: "Show disk usage per repository",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			entries, err := newRepositoryCache(&pkgproxy.Repository{}).List("/")
+			if err != nil {
+				return err
+			}
+			sizes := map[string]int64{}
+			files := map[string]int{}
+			for _, repo := range utils.KeysFromMap(repoConfig.Repositories) {
+				sizes[repo] = 0
+			}
+			var total int64
+			for _, entry := range entries {
+				sizes[entry.Repository()] += entry.Size
+				files[entry.Repository()]++
+				total += entry.Size
+			}
+			w := cmd.OutOrStdout()
+			for _, repo := range utils.KeysFromMap(sizes) {
+				note := ""
+				if _, ok := repoConfig.Repositories[repo]; !ok {
+					note = "  (not configured)"
+				}
+				fmt.Fprintf(w, "%10s  %8d  %s%s\n", utils.FormatByteSize(sizes[repo]), files[repo], repo, note)
+			}
+			fmt.Fprintf(w, "%10s  %8d  total\n", utils.FormatByteSize(total), len(entries))
+			return nil
+		},
+	}
+}
+
+func newCachePurgeCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "purge <repository>",
+		Short: "Remove cached files of a repository older than the given age",
+		Long: `Remove cached files of a repository whose modification time is older
+than the given age. The modification time of a cached file is the
+Last-Modified time reported by the upstream mirror.`,
+		Example: "  pkgproxy cache purge fedora --older-than 90d",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := lookupRepository(args[0])
+			if err != nil {
+				return err
+			}
+			age, err := utils.ParseAge(purgeOlderThan)
+			if err != nil {
+				return err
+			}
+			fc := newRepositoryCache(repo)
+			entries, err := fc.List("/" + args[0] + "/")
+			if err != nil {
+				return err
+			}
+			cutoff := time.Now().Add(-age)
+			var stale []cache.Entry
+			for _, entry := range entries {
+				if entry.ModTime.Before(cutoff) {
+					stale = append(stale, entry)
+				}
+			}
+			return removeEntries(cmd.OutOrStdout(), stale, func(entry cache.Entry) error {
+				return fc.DeleteFile(entry.URI)
+			})
+		},
+	}
+	c.Flags().StringVar(&purgeOlderThan, "older-than", "", "minimum age of the files to remove, e.g. 90d, 2w or 12h")
+	c.Flags().BoolVar(&dryRun, "dry-run", false, "only print the files that would be removed")
+	_ = c.MarkFlagRequired("older-than")
+
+	return c
+}
+
+func newCachePruneCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove cached files which are no longer cache candidates",
+		Long: `Remove cached files which are no longer cache candidates according to
+the suffixes, exclude and metadata settings of their repository, e.g.
+after the configuration was changed. Deduplicated blobs which are no
+longer referenced by any cached file are removed as well.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			caches := map[string]cache.FileCache{}
+			var obsolete []cache.Entry
+			for _, name := range utils.KeysFromMap(repoConfig.Repositories) {
+				repo := repoConfig.Repositories[name]
+				caches[name] = newRepositoryCache(&repo)
+				entries, err := caches[name].List("/" + name + "/")
+				if err != nil {
+					return err
+				}
+				for _, entry := range entries {
+					if !caches[name].IsCacheCandidate(entry.URI) {
+						obsolete = append(obsolete, entry)
+					}
+				}
+			}
+			orphaned, err := cache.ListOrphanedBlobs(cacheDir)
+			if err != nil {
+				return err
+			}
+			obsolete = append(obsolete, orphaned...)
+			return removeEntries(cmd.OutOrStdout(), obsolete, func(entry cache.Entry) error {
+				if entry.Repository() == cache.BlobDir {
+					return os.Remove(entry.Path)
+				}
+				return caches[entry.Repository()].DeleteFile(entry.URI)
+			})
+		},
+	}
+	c.Flags().BoolVar(&dryRun, "dry-run", false, "only print the files that would be removed")
+
+	return c
+}
+
+func newCacheCleanTmpCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "clean-tmp",
+		Short: "Remove temp files left behind by interrupted downloads",
+		Long: `Remove the *.tmp files left behind by interrupted downloads. Only
+files older than --older-than are removed, so that downloads which are
+still in progress in a running pkgproxy are not affected.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			age, err := utils.ParseAge(tmpFileOlderThan)
+			if err != nil {
+				return err
+			}
+			entries, err := cache.ListTemp(cacheDir)
+			if err != nil {
+				return err
+			}
+			cutoff := time.Now().Add(-age)
+			var stale []cache.Entry
+			for _, entry := range entries {
+				if entry.ModTime.Before(cutoff) {
+					stale = append(stale, entry)
+				}
+			}
+			return removeEntries(cmd.OutOrStdout(), stale, func(entry cache.Entry) error {
+				return os.Remove(entry.Path)
+			})
+		},
+	}
+	c.Flags().StringVar(&tmpFileOlderThan, "older-than", defaultTempFileAge, "minimum age of the temp files to remove")
+	c.Flags().BoolVar(&dryRun, "dry-run", false, "only print the files that would be removed")
+
+	return c
+}
+
+// lookupRepository returns the configuration of the named repository.
+func lookupRepository(name string) (*pkgproxy.Repository, error) {
+	repo, ok := repoConfig.Repositories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown repository '%s'", name)
+	}
+	return &repo, nil
+}
+
+// initStorage loads the configuration and initializes the configured cache
+// storage backend.
+func initStorage() error {
+	if err := initConfig(); err != nil {
+		return err
+	}
+	var err error
+	cacheStorage, err = repoConfig.NewStorage(cacheDir)
+	return err
+}
+
+// newRepositoryCache returns the cache of the given repository using the
+// configured storage backend.
+func newRepositoryCache(repo *pkgproxy.Repository) cache.FileCache {
+	cacheConfig := repo.CacheConfig(cacheDir)
+	cacheConfig.Storage = cacheStorage
+	return cache.New(cacheConfig)
+}
+
+// removeEntries deletes the given cached files with the remove function and
+// prints a summary. With --dry-run only the summary is printed.
+func removeEntries(w io.Writer, entries []cache.Entry, remove func(cache.Entry) error) error {
+	verb := "removed"
+	if dryRun {
+		verb = "would remove"
+	}
+	var removed int64
+	for _, entry := range entries {
+		if !dryRun {
+			if err := remove(entry); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(w, "%s %s\n", verb, entry.URI)
+		removed += entry.Size
+	}
+	fmt.Fprintf(w, "%s %d files (%s)\n", verb, len(entries), utils.FormatByteSize(removed))
+	return nil
+}
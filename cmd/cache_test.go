@@ -0,0 +1,152 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ganto/pkgproxy/pkg/pkgproxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const cacheTestConfig = `repositories:
+  testrepo:
+    suffixes: [.rpm]
+    exclude: [excluded.rpm]
+    mirrors: [https://example.com/]
+`
+
+// setupCacheTest creates a config file and a cache directory with the given
+// files (relative path → age) and returns both paths.
+func setupCacheTest(t *testing.T, files map[string]time.Duration) (string, string) {
+	t.Helper()
+	repoConfig = pkgproxy.RepoConfig{}
+	dir := t.TempDir()
+	config := filepath.Join(dir, "pkgproxy.yaml")
+	require.NoError(t, os.WriteFile(config, []byte(cacheTestConfig), 0o600))
+	cache := filepath.Join(dir, "cache")
+	for name, age := range files {
+		p := filepath.Join(cache, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o750))
+		require.NoError(t, os.WriteFile(p, []byte("content"), 0o600))
+		mtime := time.Now().Add(-age)
+		require.NoError(t, os.Chtimes(p, mtime, mtime))
+	}
+	return config, cache
+}
+
+func runCacheCommand(t *testing.T, config string, cache string, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	c := NewRootCommand()
+	c.SetOut(&out)
+	c.SetErr(&out)
+	c.SetArgs(append([]string{"--config", config, "--cachedir", cache, "cache"}, args...))
+	err := c.Execute()
+	return out.String(), err
+}
+
+func TestCacheLs(t *testing.T) {
+	config, cache := setupCacheTest(t, map[string]time.Duration{
+		"testrepo/a/one.rpm": 0,
+		"testrepo/b/two.rpm": 0,
+		"testrepo/b/3.tmp":   0,
+	})
+
+	out, err := runCacheCommand(t, config, cache, "ls", "testrepo", "b/")
+	require.NoError(t, err)
+	assert.Contains(t, out, "/testrepo/b/two.rpm")
+	assert.NotContains(t, out, "one.rpm")
+	assert.NotContains(t, out, ".tmp")
+
+	_, err = runCacheCommand(t, config, cache, "ls", "unknown")
+	assert.Error(t, err)
+}
+
+func TestCacheDu(t *testing.T) {
+	config, cache := setupCacheTest(t, map[string]time.Duration{
+		"testrepo/a/one.rpm": 0,
+		"testrepo/b/two.rpm": 0,
+		"old/three.rpm":      0,
+	})
+
+	out, err := runCacheCommand(t, config, cache, "du")
+	require.NoError(t, err)
+	assert.Regexp(t, `14B\s+2\s+testrepo\n`, out)
+	assert.Regexp(t, `7B\s+1\s+old  \(not configured\)\n`, out)
+	assert.Regexp(t, `21B\s+3\s+total\n`, out)
+}
+
+func TestCachePurge(t *testing.T) {
+	config, cache := setupCacheTest(t, map[string]time.Duration{
+		"testrepo/old.rpm": 100 * 24 * time.Hour,
+		"testrepo/new.rpm": 24 * time.Hour,
+	})
+
+	_, err := runCacheCommand(t, config, cache, "purge", "testrepo")
+	assert.Error(t, err, "--older-than is required")
+
+	out, err := runCacheCommand(t, config, cache, "purge", "testrepo", "--older-than", "90d", "--dry-run")
+	require.NoError(t, err)
+	assert.Contains(t, out, "would remove /testrepo/old.rpm")
+	assert.FileExists(t, filepath.Join(cache, "testrepo", "old.rpm"))
+
+	out, err = runCacheCommand(t, config, cache, "purge", "testrepo", "--older-than", "90d")
+	require.NoError(t, err)
+	assert.Contains(t, out, "removed 1 files")
+	assert.NoFileExists(t, filepath.Join(cache, "testrepo", "old.rpm"))
+	assert.FileExists(t, filepath.Join(cache, "testrepo", "new.rpm"))
+}
+
+func TestCachePrune(t *testing.T) {
+	config, cache := setupCacheTest(t, map[string]time.Duration{
+		"testrepo/keep.rpm":     0,
+		"testrepo/excluded.rpm": 0,
+		"testrepo/other.deb":    0,
+	})
+
+	out, err := runCacheCommand(t, config, cache, "prune")
+	require.NoError(t, err)
+	assert.Contains(t, out, "removed 2 files")
+	assert.FileExists(t, filepath.Join(cache, "testrepo", "keep.rpm"))
+	assert.NoFileExists(t, filepath.Join(cache, "testrepo", "excluded.rpm"))
+	assert.NoFileExists(t, filepath.Join(cache, "testrepo", "other.deb"))
+}
+
+func TestCachePruneOrphanedBlobs(t *testing.T) {
+	config, cache := setupCacheTest(t, map[string]time.Duration{
+		"testrepo/keep.rpm":             0,
+		".blobs/sha256/ab/abcdef012345": 0,
+	})
+	// keep.rpm is deduplicated, so its blob is still referenced
+	referenced := filepath.Join(cache, ".blobs", "sha256", "cd", "cdef01234567")
+	require.NoError(t, os.MkdirAll(filepath.Dir(referenced), 0o750))
+	require.NoError(t, os.Link(filepath.Join(cache, "testrepo", "keep.rpm"), referenced))
+
+	out, err := runCacheCommand(t, config, cache, "prune")
+	require.NoError(t, err)
+	assert.Contains(t, out, "removed 1 files")
+	assert.NoFileExists(t, filepath.Join(cache, ".blobs", "sha256", "ab", "abcdef012345"))
+	assert.FileExists(t, referenced)
+	assert.FileExists(t, filepath.Join(cache, "testrepo", "keep.rpm"))
+}
+
+func TestCacheCleanTmp(t *testing.T) {
+	config, cache := setupCacheTest(t, map[string]time.Duration{
+		"testrepo/a/123.tmp": 2 * time.Hour,
+		"testrepo/a/456.tmp": 0,
+		"testrepo/a/one.rpm": 2 * time.Hour,
+	})
+
+	out, err := runCacheCommand(t, config, cache, "clean-tmp")
+	require.NoError(t, err)
+	assert.Contains(t, out, "removed /testrepo/a/123.tmp")
+	assert.NoFileExists(t, filepath.Join(cache, "testrepo", "a", "123.tmp"))
+	assert.FileExists(t, filepath.Join(cache, "testrepo", "a", "456.tmp"), "recent temp files must be kept")
+	assert.FileExists(t, filepath.Join(cache, "testrepo", "a", "one.rpm"))
+}
@@ -0,0 +1,141 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path"
+	"regexp"
+	"syscall"
+	"time"
+
+	"github.com/ganto/pkgproxy/pkg/prefetch"
+	"github.com/ganto/pkgproxy/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	prefetchArch        string
+	prefetchConcurrency int
+	prefetchInterval    time.Duration
+	prefetchName        string
+	prefetchURL         string
+)
+
+const (
+	defaultPrefetchConcurrency = 4
+	defaultPrefetchURL         = "http://localhost:8080"
+	prefetchURLEnvVar          = "PKGPROXY_URL"
+)
+
+func newPrefetchCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "prefetch <repository> <metadata-path>...",
+		Short: "Download the packages listed in repository metadata into the cache",
+		Long: `Download the packages listed in the metadata of a repository through a
+running pkgproxy, so that they are served from its cache afterwards.
+Supported metadata files are the RPM repomd.xml and primary.xml, the
+Debian Release, InRelease and Packages files and Arch Linux package
+databases. The metadata path is relative to the repository. With
+--interval the prefetch is repeated until the command is interrupted.`,
+		Example: `  pkgproxy prefetch fedora releases/42/Everything/x86_64/os/repodata/repomd.xml --arch 'x86_64|noarch'
+  pkgproxy prefetch debian dists/bookworm/Release --arch 'amd64|all' --name '^(bash|zsh)$' --interval 24h`,
+		Args: cobra.MinimumNArgs(2),
+		PreRun: func(cmd *cobra.Command, _ []string) {
+			if !cmd.Flag("url").Changed {
+				if value, ok := os.LookupEnv(prefetchURLEnvVar); ok {
+					prefetchURL = value
+				}
+			}
+		},
+		RunE: runPrefetch,
+	}
+	c.Flags().StringVar(&prefetchURL, "url", defaultPrefetchURL, "base URL of the running pkgproxy; overrides PKGPROXY_URL.")
+	c.Flags().StringVar(&prefetchName, "name", "", "only download packages whose name matches the regular expression")
+	c.Flags().StringVar(&prefetchArch, "arch", "", "only download packages whose architecture matches the regular expression")
+	c.Flags().IntVar(&prefetchConcurrency, "concurrency", defaultPrefetchConcurrency, "number of packages downloaded in parallel")
+	c.Flags().DurationVar(&prefetchInterval, "interval", 0, "repeat the prefetch at the given interval, e.g. 24h")
+
+	return c
+}
+
+func runPrefetch(cmd *cobra.Command, args []string) error {
+	cfg := &prefetch.Config{URL: prefetchURL, Concurrency: prefetchConcurrency}
+	var err error
+	if cfg.Name, err = compileFilter("name", prefetchName); err != nil {
+		return err
+	}
+	if cfg.Arch, err = compileFilter("arch", prefetchArch); err != nil {
+		return err
+	}
+	p, err := prefetch.New(cfg)
+	if err != nil {
+		return err
+	}
+	if prefetchInterval < 0 {
+		return errors.New("invalid interval: must not be negative")
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var uris []string
+	for _, metadataPath := range args[1:] {
+		uris = append(uris, path.Join("/", args[0], metadataPath))
+	}
+	if prefetchInterval == 0 {
+		return prefetchAll(ctx, cmd.OutOrStdout(), p, uris)
+	}
+	for {
+		if err := prefetchAll(ctx, cmd.OutOrStdout(), p, uris); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			slog.Error("prefetch failed", "error", err)
+		}
+		slog.Info("next prefetch", "at", time.Now().Add(prefetchInterval).Format(time.DateTime))
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(prefetchInterval):
+		}
+	}
+}
+
+// prefetchAll prefetches the packages of every metadata file and prints a
+// summary. It returns an error if any metadata file or package failed.
+func prefetchAll(ctx context.Context, w io.Writer, p *prefetch.Prefetcher, uris []string) error {
+	failed := 0
+	for _, uri := range uris {
+		result, err := p.Run(ctx, uri)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s: fetched %d of %d packages (%s), %d failed\n",
+			uri, result.Fetched, result.Packages, utils.FormatByteSize(result.Size), result.Failed)
+		failed += result.Failed
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d packages failed to download", failed)
+	}
+	return nil
+}
+
+// compileFilter compiles the regular expression of a package filter flag.
+// An empty expression matches all packages.
+func compileFilter(flag string, expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s filter: %w", flag, err)
+	}
+	return re, nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package cmd
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runPrefetchCommand(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	c := NewRootCommand()
+	c.SetOut(&out)
+	c.SetErr(&out)
+	c.SetArgs(append([]string{"prefetch"}, args...))
+	err := c.Execute()
+	return out.String(), err
+}
+
+func TestPrefetch(t *testing.T) {
+	files := map[string]string{
+		"/testrepo/Packages": "Package: bash\nArchitecture: amd64\nFilename: bash.deb\n\n" +
+			"Package: zsh\nArchitecture: amd64\nFilename: zsh.deb\n",
+		"/testrepo/bash.deb": "bash",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	// Debian Packages files are only recognized below dists/
+	_, err := runPrefetchCommand(t, "--url", server.URL, "testrepo", "Packages")
+	assert.ErrorContains(t, err, "unsupported metadata file")
+
+	files["/testrepo/dists/stable/main/binary-amd64/Packages"] = files["/testrepo/Packages"]
+	out, err := runPrefetchCommand(t, "--url", server.URL, "--name", "^bash$", "testrepo", "dists/stable/main/binary-amd64/Packages")
+	require.NoError(t, err)
+	assert.Contains(t, out, "/testrepo/dists/stable/main/binary-amd64/Packages: fetched 1 of 1 packages (4B), 0 failed")
+
+	out, err = runPrefetchCommand(t, "--url", server.URL, "testrepo", "dists/stable/main/binary-amd64/Packages")
+	assert.ErrorContains(t, err, "1 packages failed to download")
+	assert.Contains(t, out, "fetched 1 of 2 packages")
+
+	_, err = runPrefetchCommand(t, "--url", server.URL, "--arch", "(", "testrepo", "dists/stable/main/binary-amd64/Packages")
+	assert.ErrorContains(t, err, "invalid --arch filter")
+}
@@ -18,12 +18,14 @@ var (
 	configPath  string
 	enableDebug bool
 	repoConfig  pkgproxy.RepoConfig
+	snapshotDir string
 )
 
 const (
 	configPathEnvVar  = "PKGPROXY_CONFIG"
 	defaultConfigPath = "./pkgproxy.yaml"
 	defaultDir        = "cache"
+	defaultSnapshots  = "snapshots"
 )
 
 // NewRootCommand creates a new root cli command instance
@@ -43,7 +45,11 @@ Complete documentation is available at https://github.com/ganto/pkgproxy`,
 	c.PersistentFlags().StringVar(&cacheDir, "cachedir", defaultDir, "path to the local cache directory")
 	c.PersistentFlags().StringVarP(&configPath, "config", "c", defaultConfigPath, "path to the repository config file")
 	c.PersistentFlags().BoolVar(&enableDebug, "debug", false, "enable debugging")
+	c.PersistentFlags().StringVar(&snapshotDir, "snapshotdir", defaultSnapshots, "path to the local snapshot directory")
+	c.AddCommand(newCacheCommand())
+	c.AddCommand(newPrefetchCommand())
 	c.AddCommand(newServeCommand())
+	c.AddCommand(newSnapshotCommand())
 	c.AddCommand(newVersionCommand())
 
 	return c
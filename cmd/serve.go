@@ -23,20 +23,38 @@ import (
 )
 
 var (
+	adminToken         string
+	clientCA           string
+	deleteTrusted      string
+	deleteTrustedNets  []*net.IPNet
+	disableDelete      bool
 	listenAddress      string
 	listenPort         uint16
+	metricsAddress     string
+	offline            bool
 	publicHost         string
+	tlsCert            string
+	tlsKey             string
 	trustProxy         string
 	ipExtractor        echo.IPExtractor
 	resolvedTrustProxy string
 )
 
 const (
-	defaultAddress   = "localhost"
-	defaultPort      = 8080
-	hostEnvVar       = "PKGPROXY_HOST"
-	publicHostEnvVar = "PKGPROXY_PUBLIC_HOST"
-	trustProxyEnvVar = "PKGPROXY_TRUST_PROXY"
+	defaultAddress      = "localhost"
+	defaultPort         = 8080
+	adminTokenEnvVar    = "PKGPROXY_ADMIN_TOKEN"
+	clientCAEnvVar      = "PKGPROXY_CLIENT_CA"
+	deleteTrustedEnvVar = "PKGPROXY_DELETE_TRUSTED"
+	hostEnvVar          = "PKGPROXY_HOST"
+	metricsEnvVar       = "PKGPROXY_METRICS_ADDRESS"
+	publicHostEnvVar    = "PKGPROXY_PUBLIC_HOST"
+	tlsCertEnvVar       = "PKGPROXY_TLS_CERT"
+	tlsKeyEnvVar        = "PKGPROXY_TLS_KEY"
+	trustProxyEnvVar    = "PKGPROXY_TRUST_PROXY"
+
+	defaultMetricsAddress = "localhost:8099"
+	metricsPath           = "/metrics"
 )
 
 func newServeCommand() *cobra.Command {
@@ -47,19 +65,50 @@ func newServeCommand() *cobra.Command {
 		PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
 			listenAddress = resolveListenHost(cmd.Flag("host").Changed, listenAddress, os.Getenv(hostEnvVar))
 			resolvedTrustProxy = resolveTrustProxy(cmd.Flag("trust-proxy").Changed, trustProxy, os.Getenv(trustProxyEnvVar))
+			if !cmd.Flag("admin-token").Changed {
+				adminToken = os.Getenv(adminTokenEnvVar)
+			}
+			metricsAddress = resolveMetricsAddress(cmd.Flag("metrics-address").Changed, metricsAddress, os.Getenv(metricsEnvVar))
+			if metricsAddress == "" && adminToken == "" {
+				return errors.New("serving metrics on the proxy port requires admin-token")
+			}
+			tlsCert = resolveTLSOption(cmd.Flag("tls-cert").Changed, tlsCert, os.Getenv(tlsCertEnvVar))
+			tlsKey = resolveTLSOption(cmd.Flag("tls-key").Changed, tlsKey, os.Getenv(tlsKeyEnvVar))
+			clientCA = resolveTLSOption(cmd.Flag("client-ca").Changed, clientCA, os.Getenv(clientCAEnvVar))
+			if (tlsCert == "") != (tlsKey == "") {
+				return errors.New("tls-cert and tls-key must be set together")
+			}
+			if clientCA != "" && tlsCert == "" {
+				return errors.New("client-ca requires tls-cert and tls-key")
+			}
 			var err error
 			ipExtractor, err = parseTrustProxy(resolvedTrustProxy)
 			if err != nil {
 				return err
 			}
+			if !cmd.Flag("delete-trusted").Changed {
+				deleteTrusted = os.Getenv(deleteTrustedEnvVar)
+			}
+			deleteTrustedNets, err = parseDeleteTrusted(deleteTrusted)
+			if err != nil {
+				return err
+			}
 			return initConfig()
 		},
 		RunE:             startServer,
 		TraverseChildren: true,
 	}
+	c.PersistentFlags().StringVar(&adminToken, "admin-token", "", "bearer token required for the "+pkgproxy.AdminPrefix+"/ API; overrides PKGPROXY_ADMIN_TOKEN. The admin API is disabled if empty.")
+	c.PersistentFlags().StringVar(&clientCA, "client-ca", "", "PEM bundle of the CAs that sign client certificates; requires clients to present a valid certificate; overrides PKGPROXY_CLIENT_CA.")
+	c.PersistentFlags().StringVar(&deleteTrusted, "delete-trusted", "", "comma-separated list of CIDRs or IPs allowed to DELETE cached files without the admin token; overrides PKGPROXY_DELETE_TRUSTED.")
+	c.PersistentFlags().BoolVar(&disableDelete, "disable-delete", false, "reject all DELETE requests for cached files.")
 	c.PersistentFlags().StringVar(&listenAddress, "host", defaultAddress, "listen address of the pkgproxy.")
 	c.PersistentFlags().Uint16Var(&listenPort, "port", defaultPort, "listen port of the pkgproxy.")
+	c.PersistentFlags().StringVar(&metricsAddress, "metrics-address", defaultMetricsAddress, "separate listen address (host:port) for the "+metricsPath+" endpoint; overrides PKGPROXY_METRICS_ADDRESS. If empty, metrics are served on the proxy port and require the admin token.")
+	c.PersistentFlags().BoolVar(&offline, "offline", false, "serve all repositories exclusively from the cache without contacting any upstream mirror.")
 	c.PersistentFlags().StringVar(&publicHost, "public-host", "", "public hostname (or host:port) shown in landing page config snippets; overrides PKGPROXY_PUBLIC_HOST.")
+	c.PersistentFlags().StringVar(&tlsCert, "tls-cert", "", "PEM certificate (chain) to serve HTTPS, reloaded when the file changes; overrides PKGPROXY_TLS_CERT.")
+	c.PersistentFlags().StringVar(&tlsKey, "tls-key", "", "PEM private key of the TLS certificate; overrides PKGPROXY_TLS_KEY.")
 	c.PersistentFlags().StringVar(&trustProxy, "trust-proxy", "", "comma-separated list of trusted proxy addresses for X-Forwarded-For: none, loopback, private, CIDR, or IP; overrides PKGPROXY_TRUST_PROXY.")
 
 	return c
@@ -100,6 +149,45 @@ func resolveTrustProxy(flagChanged bool, flagValue, envValue string) string {
 	return ""
 }
 
+// resolveMetricsAddress determines the metrics listen address using flag → env var → default precedence.
+// An empty address serves the metrics endpoint on the proxy listener.
+func resolveMetricsAddress(flagChanged bool, flagValue, envValue string) string {
+	if flagChanged {
+		return flagValue
+	}
+	if envValue != "" {
+		return envValue
+	}
+	return defaultMetricsAddress
+}
+
+// resolveTLSOption determines a TLS file path using flag → env var precedence.
+// An empty path disables the option.
+func resolveTLSOption(flagChanged bool, flagValue, envValue string) string {
+	if flagChanged {
+		return flagValue
+	}
+	return envValue
+}
+
+// parseDeleteTrusted parses the comma-separated CIDRs or IP addresses of the
+// clients allowed to delete cached files without the admin token.
+func parseDeleteTrusted(value string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for entry := range strings.SplitSeq(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		ipNet, err := pkgproxy.ParseNetwork(entry)
+		if err != nil {
+			return nil, fmt.Errorf("delete-trusted: %w", err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
 // parseTrustProxy converts the resolved trust-proxy string into an echo.IPExtractor.
 // Empty or "none" installs ExtractIPDirect (XFF ignored). Other values install
 // ExtractIPFromXFFHeader with only the operator-specified trust options; echo's
@@ -221,21 +309,77 @@ func startServer(_ *cobra.Command, _ []string) error {
 	})
 	app.Use(middleware.Recover())
 
+	storage, err := repoConfig.NewStorage(cacheDir)
+	if err != nil {
+		return err
+	}
+	if storage != nil {
+		slog.Info("s3 cache storage enabled", "endpoint", repoConfig.Storage.S3.Endpoint, "bucket", repoConfig.Storage.S3.Bucket)
+	}
 	pkgProxy := pkgproxy.New(&pkgproxy.PkgProxyConfig{
+		AdminToken:       adminToken,
 		CacheBasePath:    cacheDir,
+		DeleteTrusted:    deleteTrustedNets,
+		DisableDelete:    disableDelete,
 		RepositoryConfig: &repoConfig,
+		Offline:          offline,
+		SnapshotBasePath: snapshotDir,
+		Storage:          storage,
 	})
+	switch {
+	case disableDelete:
+		slog.Info("cache DELETE disabled")
+	case adminToken == "" && len(deleteTrustedNets) == 0:
+		slog.Warn("cache DELETE allowed for all clients, set admin-token, delete-trusted or disable-delete to restrict it")
+	}
+	if offline {
+		slog.Info("offline mode enabled, upstream mirrors are not contacted")
+	}
+	// Absolute-form requests of clients using pkgproxy as HTTP proxy are
+	// rewritten before routing
+	app.Pre(pkgProxy.RewriteProxyRequest)
 	publicAddr := resolvePublicAddr(publicHost, listenAddress, listenPort)
 	app.GET("/", pkgproxy.LandingHandler(&repoConfig, publicAddr))
+	if adminToken != "" {
+		pkgProxy.Admin(app.Group(pkgproxy.AdminPrefix, pkgproxy.AdminAuth(adminToken)))
+		slog.Info("admin API enabled", "prefix", pkgproxy.AdminPrefix)
+	}
 	app.Use(pkgProxy.Cache)
 	app.Use(pkgProxy.ForwardProxy)
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
+	if metricsAddress == "" {
+		// the proxy port is public, so the metrics are protected like the
+		// admin API
+		app.GET(metricsPath, echo.WrapHandler(pkgProxy.MetricsHandler()), pkgproxy.AdminAuth(adminToken))
+	} else {
+		metricsApp := echo.New()
+		metricsApp.GET(metricsPath, echo.WrapHandler(pkgProxy.MetricsHandler()))
+		go func() {
+			msc := echo.StartConfig{
+				Address:    metricsAddress,
+				HideBanner: true,
+			}
+			// the proxy keeps serving without metrics, e.g. if the port is
+			// already in use
+			if err := msc.Start(ctx, metricsApp); err != nil {
+				slog.Error("metrics server failed, metrics are not served", "address", metricsAddress, "error", err)
+			}
+		}()
+	}
+
 	sc := echo.StartConfig{
 		Address:    fmt.Sprintf("%s:%d", listenAddress, listenPort),
 		HideBanner: true,
 	}
+	if tlsCert != "" {
+		sc.TLSConfig, err = newTLSConfig(tlsCert, tlsKey, clientCA)
+		if err != nil {
+			return err
+		}
+		slog.Info("HTTPS enabled", "cert", tlsCert, "client_ca", clientCA)
+	}
 	return sc.Start(ctx, app)
 }
@@ -326,3 +326,103 @@ func TestResolvePublicAddr(t *testing.T) {
 		})
 	}
 }
+
+func TestResolveMetricsAddress(t *testing.T) {
+	tests := []struct {
+		name        string
+		flagChanged bool
+		flagValue   string
+		envValue    string
+		want        string
+	}{
+		{
+			name:        "flag changed wins over env var",
+			flagChanged: true,
+			flagValue:   "localhost:9090",
+			envValue:    "0.0.0.0:8099",
+			want:        "localhost:9090",
+		},
+		{
+			name:        "env var used when flag unchanged",
+			flagChanged: false,
+			flagValue:   "",
+			envValue:    "0.0.0.0:8099",
+			want:        "0.0.0.0:8099",
+		},
+		{
+			name:        "neither set uses the default listener",
+			flagChanged: false,
+			flagValue:   "",
+			envValue:    "",
+			want:        defaultMetricsAddress,
+		},
+		{
+			name:        "empty flag serves metrics on the proxy port",
+			flagChanged: true,
+			flagValue:   "",
+			envValue:    "0.0.0.0:8099",
+			want:        "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resolveMetricsAddress(tt.flagChanged, tt.flagValue, tt.envValue)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestResolveTLSOption(t *testing.T) {
+	tests := []struct {
+		name        string
+		flagChanged bool
+		flagValue   string
+		envValue    string
+		want        string
+	}{
+		{
+			name:        "flag changed wins over env var",
+			flagChanged: true,
+			flagValue:   "/etc/pkgproxy/tls.crt",
+			envValue:    "/run/secrets/tls.crt",
+			want:        "/etc/pkgproxy/tls.crt",
+		},
+		{
+			name:        "env var used when flag unchanged",
+			flagChanged: false,
+			flagValue:   "",
+			envValue:    "/run/secrets/tls.crt",
+			want:        "/run/secrets/tls.crt",
+		},
+		{
+			name:        "neither set disables TLS",
+			flagChanged: false,
+			flagValue:   "",
+			envValue:    "",
+			want:        "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resolveTLSOption(tt.flagChanged, tt.flagValue, tt.envValue)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseDeleteTrusted(t *testing.T) {
+	nets, err := parseDeleteTrusted("")
+	assert.NoError(t, err)
+	assert.Empty(t, nets)
+
+	nets, err = parseDeleteTrusted("10.0.0.0/8, 192.168.1.10,2001:db8::1")
+	assert.NoError(t, err)
+	if assert.Len(t, nets, 3) {
+		assert.Equal(t, "10.0.0.0/8", nets[0].String())
+		assert.Equal(t, "192.168.1.10/32", nets[1].String())
+		assert.Equal(t, "2001:db8::1/128", nets[2].String())
+	}
+
+	_, err = parseDeleteTrusted("10.0.0.0/8,not-an-ip")
+	assert.Error(t, err)
+}
@@ -0,0 +1,102 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ganto/pkgproxy/pkg/cache"
+	"github.com/ganto/pkgproxy/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+func newSnapshotCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Manage repository metadata snapshots",
+		Long: `Manage named snapshots of the cached metadata of a repository. A
+running pkgproxy serves the metadata of a snapshot immutably below
+/<repository>@<name>/, while the packages are served from the shared
+cache. The commands operate directly on --cachedir, or the configured storage
+backend, and --snapshotdir.`,
+		Args: cobra.NoArgs,
+		PersistentPreRunE: func(_ *cobra.Command, _ []string) error {
+			return initStorage()
+		},
+	}
+	c.AddCommand(newSnapshotCreateCommand())
+	c.AddCommand(newSnapshotLsCommand())
+	c.AddCommand(newSnapshotRmCommand())
+
+	return c
+}
+
+func newSnapshotCreateCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:     "create <repository> <name>",
+		Short:   "Create a snapshot of the cached metadata of a repository",
+		Example: "  pkgproxy snapshot create fedora 2026-10-01",
+		Args:    cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, err := lookupRepository(args[0])
+			if err != nil {
+				return err
+			}
+			if !cache.ValidSnapshotName(args[1]) {
+				return fmt.Errorf("invalid snapshot name '%s'. Must be alphanumeric or in '-', '_', '.'", args[1])
+			}
+			snapshot, err := cache.NewSnapshotStore(snapshotDir).Create(newRepositoryCache(repo), args[0], args[1])
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "created snapshot %s@%s with %d files (%s)\n",
+				snapshot.Repository, snapshot.Name, snapshot.Files, utils.FormatByteSize(snapshot.Size))
+			return nil
+		},
+	}
+}
+
+func newSnapshotLsCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "ls [repository]",
+		Short: "List snapshots",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo := ""
+			if len(args) > 0 {
+				if _, err := lookupRepository(args[0]); err != nil {
+					return err
+				}
+				repo = args[0]
+			}
+			snapshots, err := cache.NewSnapshotStore(snapshotDir).List(repo)
+			if err != nil {
+				return err
+			}
+			for _, snapshot := range snapshots {
+				fmt.Fprintf(cmd.OutOrStdout(), "%10s  %8d  %s  %s@%s\n", utils.FormatByteSize(snapshot.Size),
+					snapshot.Files, snapshot.Created.Format(time.DateTime), snapshot.Repository, snapshot.Name)
+			}
+			return nil
+		},
+	}
+}
+
+func newSnapshotRmCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rm <repository> <name>",
+		Short: "Remove a snapshot",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := lookupRepository(args[0]); err != nil {
+				return err
+			}
+			if err := cache.NewSnapshotStore(snapshotDir).Delete(args[0], args[1]); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "removed snapshot %s@%s\n", args[0], args[1])
+			return nil
+		},
+	}
+}
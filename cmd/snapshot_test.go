@@ -0,0 +1,67 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const snapshotTestConfig = `repositories:
+  testrepo:
+    suffixes: [.rpm]
+    metadata:
+      patterns: [repomd.xml]
+    mirrors: [https://example.com/]
+`
+
+func runSnapshotCommand(t *testing.T, config string, cache string, snapshots string, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	c := NewRootCommand()
+	c.SetOut(&out)
+	c.SetErr(&out)
+	c.SetArgs(append([]string{"--config", config, "--cachedir", cache, "--snapshotdir", snapshots, "snapshot"}, args...))
+	err := c.Execute()
+	return out.String(), err
+}
+
+func TestSnapshot(t *testing.T) {
+	config, cache := setupCacheTest(t, map[string]time.Duration{
+		"testrepo/os/repodata/repomd.xml": 0,
+		"testrepo/os/Packages/a.rpm":      0,
+	})
+	require.NoError(t, os.WriteFile(config, []byte(snapshotTestConfig), 0o600))
+	snapshots := filepath.Join(t.TempDir(), "snapshots")
+
+	out, err := runSnapshotCommand(t, config, cache, snapshots, "create", "testrepo", "2026-10-01")
+	require.NoError(t, err)
+	assert.Contains(t, out, "created snapshot testrepo@2026-10-01 with 1 files")
+	assert.FileExists(t, filepath.Join(snapshots, "testrepo", "2026-10-01", "os", "repodata", "repomd.xml"))
+	assert.NoFileExists(t, filepath.Join(snapshots, "testrepo", "2026-10-01", "os", "Packages", "a.rpm"))
+
+	_, err = runSnapshotCommand(t, config, cache, snapshots, "create", "testrepo", "2026-10-01")
+	assert.Error(t, err)
+	_, err = runSnapshotCommand(t, config, cache, snapshots, "create", "testrepo", "../x")
+	assert.Error(t, err)
+	_, err = runSnapshotCommand(t, config, cache, snapshots, "create", "unknown", "2026-10-01")
+	assert.Error(t, err)
+
+	out, err = runSnapshotCommand(t, config, cache, snapshots, "ls")
+	require.NoError(t, err)
+	assert.Contains(t, out, "testrepo@2026-10-01")
+
+	out, err = runSnapshotCommand(t, config, cache, snapshots, "rm", "testrepo", "2026-10-01")
+	require.NoError(t, err)
+	assert.Contains(t, out, "removed snapshot testrepo@2026-10-01")
+	assert.NoDirExists(t, filepath.Join(snapshots, "testrepo", "2026-10-01"))
+
+	_, err = runSnapshotCommand(t, config, cache, snapshots, "rm", "testrepo", "2026-10-01")
+	assert.Error(t, err)
+}
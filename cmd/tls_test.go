@@ -0,0 +1,152 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCert is a certificate signed by parent, or self-signed if parent is nil.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, name string, parent *testCert, isCA bool) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if isCA {
+		template.KeyUsage = x509.KeyUsageCertSign
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// write stores the certificate and key in dir and returns their paths.
+func (c *testCert) write(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+// touch sets the modification time of the files to the future, as the
+// rewritten files may have the same timestamp as before on coarse file
+// systems.
+func touch(t *testing.T, offset time.Duration, paths ...string) {
+	t.Helper()
+	for _, path := range paths {
+		mtime := time.Now().Add(offset)
+		require.NoError(t, os.Chtimes(path, mtime, mtime))
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	interval := certCheckInterval
+	certCheckInterval = 0
+	t.Cleanup(func() { certCheckInterval = interval })
+
+	dir := t.TempDir()
+	first := newTestCert(t, "first.example.com", nil, false)
+	certFile, keyFile := first.write(t, dir)
+	reloader, err := newCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+
+	cert, err := reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "first.example.com", cert.Leaf.Subject.CommonName)
+
+	second := newTestCert(t, "second.example.com", nil, false)
+	second.write(t, dir)
+	touch(t, time.Minute, certFile, keyFile)
+	cert, err = reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "second.example.com", cert.Leaf.Subject.CommonName)
+
+	// an invalid certificate keeps the previous one
+	require.NoError(t, os.WriteFile(certFile, []byte("invalid"), 0o600))
+	touch(t, 2*time.Minute, certFile)
+	cert, err = reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "second.example.com", cert.Leaf.Subject.CommonName)
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil, true)
+	server := newTestCert(t, "localhost", ca, false)
+	certFile, keyFile := server.write(t, dir)
+	caFile := filepath.Join(dir, "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.der}), 0o600))
+
+	_, err := newTLSConfig(certFile, "", "")
+	require.Error(t, err)
+	_, err = newTLSConfig(certFile, keyFile, filepath.Join(dir, "missing.crt"))
+	require.Error(t, err)
+
+	config, err := newTLSConfig(certFile, keyFile, caFile)
+	require.NoError(t, err)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	ts.TLS = config
+	ts.StartTLS()
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(client *testCert) error {
+		tlsConfig := &tls.Config{RootCAs: roots, ServerName: "localhost", MinVersion: tls.VersionTLS12}
+		if client != nil {
+			tlsConfig.Certificates = []tls.Certificate{{Certificate: [][]byte{client.der}, PrivateKey: client.key}}
+		}
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		rsp, err := c.Get(ts.URL)
+		if err != nil {
+			return err
+		}
+		return rsp.Body.Close()
+	}
+	assert.Error(t, get(nil), "a client certificate is required")
+	assert.Error(t, get(newTestCert(t, "client", nil, false)), "the client certificate must be signed by the client CA")
+	assert.NoError(t, get(newTestCert(t, "client", ca, false)))
+}
@@ -4,10 +4,12 @@ package cache
 
 import (
 	"bytes"
-	"errors"
+	"context"
 	"fmt"
-	"log/slog"
+	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
@@ -16,22 +18,28 @@ import (
 )
 
 type FileCache interface {
-	// Create a temp file in the cache directory for the given URI, suitable
-	// for streaming writes. Creates parent directories and validates path
-	// traversal. The caller is responsible for closing the returned file.
-	CreateTempWriter(uri string) (*os.File, error)
+	// Create a temp file for the given URI, suitable for streaming writes.
+	// Creates parent directories and validates path traversal. The caller is
+	// responsible for closing the returned file.
+	CreateTempWriter(uri string) (TempFile, error)
 
 	// Atomically commit a temp file into the cache by setting its mtime
-	// and renaming it to the final path for the given URI. Trusts that
+	// and moving it to the final location for the given URI. Trusts that
 	// the URI was already validated by CreateTempWriter.
 	CommitTempFile(tmpPath string, uri string, mtime time.Time) error
 
 	// Remove cached file for given URL
 	DeleteFile(string) error
 
-	// Return file system path to cached file for given URL. If the URL points
-	// to a path outside the cache directory return an error.
-	GetFilePath(string) (string, error)
+	// Open the cached file for given URL for reading. The caller is
+	// responsible for closing the returned file.
+	Open(string) (File, error)
+
+	// Return the file info of the cached file for given URL
+	Stat(string) (fs.FileInfo, error)
+
+	// Return the cached files whose URI starts with the given prefix
+	List(string) ([]Entry, error)
 
 	// Returns a list of file suffixes that will be cached
 	GetFileSuffixes() []string
@@ -39,42 +47,121 @@ type FileCache interface {
 	// Return if URL is supposed to be cached
 	IsCacheCandidate(string) bool
 
+	// Return if URL points to repository metadata which must be revalidated
+	// with the upstream server once it expired
+	IsMetadata(string) bool
+
+	// Return the metadata stored alongside the cached file for given URL
+	GetMetadata(string) (*Metadata, error)
+
+	// Store metadata alongside the cached file for given URL
+	SetMetadata(string, *Metadata) error
+
 	// Return if file exists in cache for given URL
 	IsCached(string) bool
 
+	// Record an access to the cached file for given URL and protect it from
+	// eviction until the returned release function is called
+	Pin(string) func()
+
 	// Save buffer as file in cache for given URL
 	SaveToDisk(string, *bytes.Buffer, time.Time) error
+
+	// Return a copy of the cache whose storage requests are canceled
+	// together with the given context, e.g. for lookups while serving a
+	// client request
+	WithContext(context.Context) FileCache
+}
+
+// contextStorage is implemented by storage backends sending requests which
+// can be bound to a context.
+type contextStorage interface {
+	WithContext(ctx context.Context) Storage
 }
 
 type cache struct {
-	config *CacheConfig
+	config  *CacheConfig
+	storage Storage
 }
 
 type CacheConfig struct {
-	// Local file system base path for storing cached files
+	// Local file system base path for storing cached files. Temp files of
+	// downloads in progress are stored below the base path for all storage
+	// backends.
 	BasePath string
 
+	// Optional storage backend holding the cached files. The files are
+	// stored below BasePath if nil.
+	Storage Storage
+
 	// List of file suffixes that will be cached
 	FileSuffixes []string
 
 	// List of filenames or suffixes that are never cached
 	Exclude []string
+
+	// List of filename patterns of repository metadata. Metadata files are
+	// cached but must be revalidated by the caller once they expire.
+	Metadata []string
+
+	// Optional quota bookkeeping shared by all repository caches. Only used
+	// for files stored below BasePath.
+	Evictor *Evictor
+
+	// Store files with the same content only once by hardlinking them to a
+	// content-addressed blob. Metadata files are never deduplicated. Only
+	// used for files stored below BasePath.
+	Deduplicate bool
 }
 
 func New(cfg *CacheConfig) FileCache {
-	return &cache{
-		config: cfg,
+	c := &cache{
+		config:  cfg,
+		storage: cfg.Storage,
+	}
+	if c.storage == nil {
+		c.storage = &localStorage{config: cfg}
 	}
+	return c
 }
 
 // Delete file from cache
 func (c *cache) DeleteFile(uri string) error {
-	p, err := c.resolvedFilePath(uri)
+	name, err := c.resolvedName(uri)
 	if err != nil {
 		return err
 	}
-	slog.Info("cache delete", "path", p)
-	return os.Remove(p)
+	return c.storage.Remove(name)
+}
+
+// Opens the cached file for reading
+func (c *cache) Open(uri string) (File, error) {
+	name, err := c.resolvedName(uri)
+	if err != nil {
+		return nil, err
+	}
+	return c.storage.Open(name)
+}
+
+// Returns the file info of the cached file
+func (c *cache) Stat(uri string) (fs.FileInfo, error) {
+	name, err := c.resolvedName(uri)
+	if err != nil {
+		return nil, err
+	}
+	return c.storage.Stat(name)
+}
+
+// Returns the cached files whose URI starts with prefix
+func (c *cache) List(prefix string) ([]Entry, error) {
+	name := strings.TrimLeft(prefix, "/")
+	if name != "" {
+		cleaned := path.Clean(name)
+		if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+			return nil, fmt.Errorf("prefix %q resolves outside the cache directory", prefix)
+		}
+	}
+	return c.storage.List(name)
 }
 
 // Returns the local file system base path for storing the files
@@ -95,9 +182,14 @@ func (c *cache) resolvedFilePath(uri string) (string, error) {
 	return p, nil
 }
 
-// Returns the path to the cached file
-func (c *cache) GetFilePath(uri string) (string, error) {
-	return c.resolvedFilePath(uri)
+// resolvedName returns the storage name for the given URI, verifying it
+// remains within the cache.
+func (c *cache) resolvedName(uri string) (string, error) {
+	name := path.Clean(strings.TrimLeft(filepath.ToSlash(uri), "/"))
+	if name == "." || name == ".." || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("URI %q resolves outside the cache directory", uri)
+	}
+	return name, nil
 }
 
 // Returns a list of file suffixes that will be cached
@@ -109,6 +201,11 @@ func (c *cache) GetFileSuffixes() []string {
 func (c *cache) IsCacheCandidate(uri string) bool {
 	name := utils.FilenameFromURI(uri)
 
+	// Never shadow the metadata sidecar files.
+	if isSidecarFile(name) {
+		return false
+	}
+
 	// Exclude check first: exact name match or suffix match.
 	for _, entry := range c.config.Exclude {
 		if name == entry || strings.HasSuffix(name, entry) {
@@ -116,6 +213,10 @@ func (c *cache) IsCacheCandidate(uri string) bool {
 		}
 	}
 
+	if c.IsMetadata(uri) {
+		return true
+	}
+
 	// Wildcard: "*" in suffixes means cache everything (that wasn't excluded).
 	for _, suffix := range c.GetFileSuffixes() {
 		if suffix == "*" {
@@ -133,55 +234,68 @@ func (c *cache) IsCacheCandidate(uri string) bool {
 	return false
 }
 
-// Verifies if the file is already cached
-func (c *cache) IsCached(uri string) bool {
-	p, err := c.resolvedFilePath(uri)
-	if err != nil {
-		return false
+// Verifies if the file URI matches one of the metadata patterns
+func (c *cache) IsMetadata(uri string) bool {
+	return isMetadata(c.config.Metadata, uri)
+}
+
+// isMetadata reports whether the file name of uri matches one of the
+// metadata patterns.
+func isMetadata(patterns []string, uri string) bool {
+	name := utils.FilenameFromURI(uri)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// WithContext returns a shallow copy of the cache using ctx for the requests
+// of its storage. The cache itself is returned for local storage.
+func (c *cache) WithContext(ctx context.Context) FileCache {
+	s, ok := c.storage.(contextStorage)
+	if !ok {
+		return c
 	}
+	return &cache{config: c.config, storage: s.WithContext(ctx)}
+}
 
-	_, err = os.Stat(p)
+// Verifies if the file is already cached
+func (c *cache) IsCached(uri string) bool {
+	_, err := c.Stat(uri)
 	return err == nil
 }
 
-// CreateTempWriter creates a temporary file in the correct cache subdirectory
-// for the given URI, creating parent directories as needed.
-func (c *cache) CreateTempWriter(uri string) (*os.File, error) {
-	filePath, err := c.resolvedFilePath(uri)
+// CreateTempWriter creates a temp file for the given URI, creating parent
+// directories as needed.
+func (c *cache) CreateTempWriter(uri string) (TempFile, error) {
+	name, err := c.resolvedName(uri)
 	if err != nil {
 		return nil, err
 	}
-
-	dir := filepath.Dir(filePath)
-	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
-		if err := os.MkdirAll(dir, 0o750); err != nil {
-			return nil, err
-		}
-	}
-
-	return os.CreateTemp(dir, "*.tmp")
+	return c.storage.CreateTemp(name)
 }
 
-// CommitTempFile atomically moves a temp file to the final cache path for the
+// CommitTempFile atomically moves a temp file to the final location for the
 // given URI and sets the file modification time. It trusts that the URI was
 // already validated by CreateTempWriter.
 func (c *cache) CommitTempFile(tmpPath string, uri string, mtime time.Time) error {
-	filePath, err := c.resolvedFilePath(uri)
+	name, err := c.resolvedName(uri)
 	if err != nil {
 		return err
 	}
+	return c.storage.Commit(tmpPath, name, mtime)
+}
 
-	info, err := os.Stat(tmpPath)
+// Pin marks the cached file as recently used and protects it from eviction
+// until the returned function is called.
+func (c *cache) Pin(uri string) func() {
+	p, err := c.resolvedFilePath(uri)
 	if err != nil {
-		return err
+		return func() {}
 	}
-
-	if err := os.Chtimes(tmpPath, time.Now().Local(), mtime); err != nil {
-		return err
-	}
-
-	slog.Info("cache write", "path", filePath, "bytes", info.Size())
-	return os.Rename(tmpPath, filePath)
+	return c.config.Evictor.Pin(p)
 }
 
 // Saves buffer to file
@@ -192,7 +306,7 @@ func (c *cache) SaveToDisk(uri string, buffer *bytes.Buffer, fileTime time.Time)
 	}
 	tmpPath := tmpFile.Name()
 
-	_, err = tmpFile.ReadFrom(buffer)
+	_, err = io.Copy(tmpFile, buffer)
 	closeErr := tmpFile.Close()
 	if err != nil {
 		_ = os.Remove(tmpPath)
@@ -4,6 +4,7 @@ package cache
 
 import (
 	"bytes"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
@@ -141,7 +142,7 @@ func TestCommitTempFile(t *testing.T) {
 		// Create a temp file via CreateTempWriter
 		f, err := c.CreateTempWriter("/myrepo/package.rpm")
 		require.NoError(t, err)
-		_, err = f.WriteString("test content")
+		_, err = io.WriteString(f, "test content")
 		require.NoError(t, err)
 		tmpPath := f.Name()
 		require.NoError(t, f.Close())
@@ -169,7 +170,7 @@ func TestCommitTempFile(t *testing.T) {
 
 		f, err := c.CreateTempWriter("/myrepo/package.rpm")
 		require.NoError(t, err)
-		_, err = f.WriteString("data")
+		_, err = io.WriteString(f, "data")
 		require.NoError(t, err)
 		tmpPath := f.Name()
 		require.NoError(t, f.Close())
@@ -289,3 +290,49 @@ func TestSaveToDiskStillWorks(t *testing.T) {
 
 	assert.True(t, c.IsCached("/myrepo/path/package.rpm"))
 }
+
+func TestIsMetadata(t *testing.T) {
+	c := New(&CacheConfig{
+		BasePath:     "/cache",
+		FileSuffixes: []string{".rpm"},
+		Exclude:      []string{"excluded.xml"},
+		Metadata:     []string{"repomd.xml", "Packages*", "*.db", "excluded.xml"},
+	})
+
+	assert.True(t, c.IsMetadata("/repo/repodata/repomd.xml"))
+	assert.True(t, c.IsMetadata("/repo/dists/main/binary-amd64/Packages.xz"))
+	assert.True(t, c.IsMetadata("/repo/core/os/x86_64/core.db"))
+	assert.False(t, c.IsMetadata("/repo/Packages/p/package.rpm"))
+
+	// metadata files are cache candidates unless excluded
+	assert.True(t, c.IsCacheCandidate("/repo/repodata/repomd.xml"))
+	assert.False(t, c.IsCacheCandidate("/repo/excluded.xml"))
+	assert.False(t, c.IsCacheCandidate("/repo/repodata/other.xml"))
+}
+
+func TestMetadataSidecar(t *testing.T) {
+	baseDir := t.TempDir()
+	c := New(&CacheConfig{BasePath: baseDir, FileSuffixes: []string{"*"}})
+
+	// no metadata stored yet
+	m, err := c.GetMetadata("/repo/repodata/repomd.xml")
+	require.NoError(t, err)
+	assert.Empty(t, m.ETag)
+	assert.True(t, m.Validated.IsZero())
+
+	require.NoError(t, c.SaveToDisk("/repo/repodata/repomd.xml", bytes.NewBufferString("<repomd/>"), time.Now()))
+	validated := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, c.SetMetadata("/repo/repodata/repomd.xml", &Metadata{ETag: `"abc"`, Validated: validated}))
+
+	m, err = c.GetMetadata("/repo/repodata/repomd.xml")
+	require.NoError(t, err)
+	assert.Equal(t, `"abc"`, m.ETag)
+	assert.Equal(t, validated, m.Validated.UTC())
+
+	// the sidecar file is never served as cached file
+	assert.False(t, c.IsCacheCandidate("/repo/repodata/repomd.xml"+sidecarSuffix))
+
+	// deleting the cached file removes its metadata
+	require.NoError(t, c.DeleteFile("/repo/repodata/repomd.xml"))
+	assert.NoFileExists(t, filepath.Join(baseDir, "repo", "repodata", "repomd.xml"+sidecarSuffix))
+}
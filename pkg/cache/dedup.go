@@ -0,0 +1,160 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BlobDir is the directory below the cache base path holding the
+// content-addressed files if deduplication is enabled. Each blob is a
+// hardlink shared by all cached files with the same content, so the number
+// of links of a blob is the number of cached files referencing it plus one.
+const BlobDir = ".blobs"
+
+// inode identifies the data of a file on disk. Hardlinked files share the
+// same inode.
+type inode struct {
+	dev uint64
+	ino uint64
+}
+
+// blobPath returns the path of the blob with the given SHA-256 checksum.
+func blobPath(basePath string, sum string) string {
+	return filepath.Join(basePath, BlobDir, "sha256", sum[:2], sum)
+}
+
+// isBlobDir reports whether p is the blob directory below basePath.
+func isBlobDir(basePath string, p string) bool {
+	return p == filepath.Join(basePath, BlobDir)
+}
+
+// dedup replaces the temp file with a hardlink to the blob with the same
+// content or, if there is none yet, adds it as new blob. As hardlinks share
+// the modification time, the temp file is only linked to a blob with the same
+// modification time. It returns the SHA-256 checksum of the file, or an empty
+// string if the file isn't deduplicated.
+func (s *localStorage) dedup(tmpPath string, info fs.FileInfo) (string, error) {
+	if _, ok := linkCount(info); !ok {
+		return "", nil
+	}
+	sum, err := hashFile(tmpPath)
+	if err != nil {
+		return "", err
+	}
+	blob := blobPath(s.config.BasePath, sum)
+	if err := os.MkdirAll(filepath.Dir(blob), 0o750); err != nil {
+		return "", err
+	}
+	// retry once if the blob is released while it is linked
+	for range 2 {
+		err := os.Link(tmpPath, blob)
+		if err == nil {
+			return sum, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return "", err
+		}
+		blobInfo, err := os.Stat(blob)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		if !blobInfo.ModTime().Equal(info.ModTime()) {
+			return "", nil
+		}
+		link := strings.TrimSuffix(tmpPath, ".tmp") + ".link.tmp"
+		if err := os.Link(blob, link); errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		if err := os.Rename(link, tmpPath); err != nil {
+			_ = os.Remove(link)
+			return "", err
+		}
+		slog.Debug("cache dedup", "blob", blob)
+		return sum, nil
+	}
+	return "", errors.New("blob removed concurrently")
+}
+
+// blobChecksum returns the checksum of the blob the cached file at p is
+// linked to, or an empty string if it isn't deduplicated.
+func blobChecksum(p string) string {
+	data, err := os.ReadFile(sidecarPath(p)) //nolint:gosec // path of a cached file
+	if err != nil {
+		return ""
+	}
+	m := &Metadata{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return ""
+	}
+	return m.SHA256
+}
+
+// releaseBlob removes the blob with the given checksum once no cached file
+// references it anymore.
+func releaseBlob(basePath string, sum string) {
+	blob := blobPath(basePath, sum)
+	info, err := os.Stat(blob)
+	if err != nil {
+		return
+	}
+	if n, ok := linkCount(info); ok && n <= 1 {
+		slog.Info("cache blob release", "blob", blob, "bytes", info.Size())
+		_ = os.Remove(blob)
+	}
+}
+
+// removeFile removes the cached file at p including its sidecar file and
+// releases its blob.
+func removeFile(basePath string, p string) error {
+	sum := blobChecksum(p)
+	if err := os.Remove(p); err != nil {
+		return err
+	}
+	removeSidecar(p)
+	if sum != "" {
+		releaseBlob(basePath, sum)
+	}
+	return nil
+}
+
+// ListOrphanedBlobs returns the blobs below basePath which are not referenced
+// by any cached file anymore, e.g. because pkgproxy was interrupted while
+// removing a file.
+func ListOrphanedBlobs(basePath string) ([]Entry, error) {
+	return walk(basePath, "/"+BlobDir+"/", func(p string) bool {
+		info, err := os.Stat(p)
+		if err != nil {
+			return false
+		}
+		n, ok := linkCount(info)
+		return ok && n <= 1 && !isTempFile(p)
+	})
+}
+
+// hashFile returns the hex encoded SHA-256 checksum of the file at p.
+func hashFile(p string) (string, error) {
+	f, err := os.Open(p) //nolint:gosec // path of a cache temp file
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
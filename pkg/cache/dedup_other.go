@@ -0,0 +1,21 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !unix
+
+package cache
+
+import (
+	"io/fs"
+)
+
+// linkCount returns false as the number of hardlinks is not available on
+// this platform. Deduplication is therefore disabled.
+func linkCount(_ fs.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+// inodeOf returns false as the inode is not available on this platform.
+func inodeOf(_ fs.FileInfo) (inode, bool) {
+	return inode{}, false
+}
@@ -0,0 +1,193 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unix
+
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blobs returns the paths of all blobs below baseDir.
+func blobs(t *testing.T, baseDir string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(baseDir, BlobDir, "sha256", "*", "*"))
+	require.NoError(t, err)
+	return matches
+}
+
+// commitSameTime commits content to uri with a fixed modification time, so
+// that files with the same content share a blob.
+func commitSameTime(t *testing.T, c FileCache, uri string, content string) {
+	t.Helper()
+	f, err := c.CreateTempWriter(uri)
+	require.NoError(t, err)
+	_, err = f.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.NoError(t, c.CommitTempFile(f.Name(), uri, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)))
+}
+
+func sameFile(t *testing.T, a string, b string) bool {
+	t.Helper()
+	infoA, err := os.Stat(a)
+	require.NoError(t, err)
+	infoB, err := os.Stat(b)
+	require.NoError(t, err)
+	return os.SameFile(infoA, infoB)
+}
+
+func TestDeduplicate(t *testing.T) {
+	baseDir := t.TempDir()
+	c := New(&CacheConfig{BasePath: baseDir, Deduplicate: true})
+
+	commitSameTime(t, c, "/fedora/a.rpm", "content")
+	commitSameTime(t, c, "/centos/a.rpm", "content")
+	commitSameTime(t, c, "/centos/b.rpm", "other")
+
+	a1 := filepath.Join(baseDir, "fedora", "a.rpm")
+	a2 := filepath.Join(baseDir, "centos", "a.rpm")
+	assert.True(t, sameFile(t, a1, a2))
+	assert.Len(t, blobs(t, baseDir), 2)
+	m, err := c.GetMetadata("/fedora/a.rpm")
+	require.NoError(t, err)
+	assert.Len(t, m.SHA256, 64)
+
+	// blobs are not listed as cached files
+	entries, err := List(baseDir, "/")
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+
+	// the blob is only removed with the last file referencing it
+	require.NoError(t, c.DeleteFile("/fedora/a.rpm"))
+	assert.Len(t, blobs(t, baseDir), 2)
+	assert.FileExists(t, a2)
+	require.NoError(t, c.DeleteFile("/centos/a.rpm"))
+	assert.Len(t, blobs(t, baseDir), 1)
+	assert.NoFileExists(t, sidecarPath(a2))
+
+	orphaned, err := ListOrphanedBlobs(baseDir)
+	require.NoError(t, err)
+	assert.Empty(t, orphaned)
+}
+
+func TestDeduplicateOverwrite(t *testing.T) {
+	baseDir := t.TempDir()
+	c := New(&CacheConfig{BasePath: baseDir, Deduplicate: true})
+
+	commitSameTime(t, c, "/repo/a.rpm", "old")
+	commitSameTime(t, c, "/repo/a.rpm", "new")
+	assert.Len(t, blobs(t, baseDir), 1, "blob of the replaced file must be released")
+
+	// files written without deduplication drop the reference to the blob
+	c = New(&CacheConfig{BasePath: baseDir})
+	commitSameTime(t, c, "/repo/a.rpm", "plain")
+	assert.Empty(t, blobs(t, baseDir))
+	m, err := c.GetMetadata("/repo/a.rpm")
+	require.NoError(t, err)
+	assert.Empty(t, m.SHA256)
+}
+
+func TestDeduplicateSkipsMetadata(t *testing.T) {
+	baseDir := t.TempDir()
+	c := New(&CacheConfig{BasePath: baseDir, Deduplicate: true, Metadata: []string{"repomd.xml"}})
+
+	commitSameTime(t, c, "/fedora/repodata/repomd.xml", "metadata")
+	commitSameTime(t, c, "/centos/repodata/repomd.xml", "metadata")
+	assert.Empty(t, blobs(t, baseDir))
+}
+
+func TestDeduplicateEviction(t *testing.T) {
+	baseDir := t.TempDir()
+	e := NewEvictor(baseDir, 10)
+	c := New(&CacheConfig{BasePath: baseDir, Evictor: e, Deduplicate: true})
+
+	commitSameTime(t, c, "/repo/a.rpm", "aaaa")
+	commitSameTime(t, c, "/repo/b.rpm", "bbbb")
+	commitSameTime(t, c, "/repo/c.rpm", "cccc")
+	assert.False(t, c.IsCached("/repo/a.rpm"))
+	assert.Len(t, blobs(t, baseDir), 2)
+
+	// quotas account for the logical size and ignore the blobs
+	require.NoError(t, e.Scan())
+	assert.Equal(t, int64(8), e.TotalUsage())
+}
+
+func TestDeduplicateEvictionCountsInodeOnce(t *testing.T) {
+	baseDir := t.TempDir()
+	e := NewEvictor(baseDir, 0)
+	c := New(&CacheConfig{BasePath: baseDir, Evictor: e, Deduplicate: true})
+
+	commitSameTime(t, c, "/fedora/a.rpm", "aaaa")
+	commitSameTime(t, c, "/fedora/b.rpm", "aaaa")
+	commitSameTime(t, c, "/centos/a.rpm", "aaaa")
+	assert.Equal(t, int64(4), e.TotalUsage())
+	assert.Equal(t, int64(4), e.Usage("fedora"))
+	assert.Equal(t, int64(4), e.Usage("centos"))
+
+	require.NoError(t, c.DeleteFile("/fedora/a.rpm"))
+	assert.Equal(t, int64(4), e.Usage("fedora"))
+	require.NoError(t, c.DeleteFile("/fedora/b.rpm"))
+	assert.Equal(t, int64(0), e.Usage("fedora"))
+	assert.Equal(t, int64(4), e.TotalUsage())
+
+	// the scan of an existing cache accounts the same way
+	e = NewEvictor(baseDir, 0)
+	commitSameTime(t, New(&CacheConfig{BasePath: baseDir, Deduplicate: true}), "/centos/b.rpm", "aaaa")
+	require.NoError(t, e.Scan())
+	assert.Equal(t, int64(4), e.TotalUsage())
+	assert.Equal(t, int64(4), e.Usage("centos"))
+}
+
+func TestDeduplicateModTime(t *testing.T) {
+	baseDir := t.TempDir()
+	c := New(&CacheConfig{BasePath: baseDir, Deduplicate: true})
+
+	commit := func(uri string, mtime time.Time) string {
+		f, err := c.CreateTempWriter(uri)
+		require.NoError(t, err)
+		_, err = f.Write([]byte("content"))
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		require.NoError(t, c.CommitTempFile(f.Name(), uri, mtime))
+		return filepath.Join(baseDir, filepath.FromSlash(uri))
+	}
+	mtimes := map[string]time.Time{
+		commit("/fedora/a.rpm", time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)): time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		commit("/centos/a.rpm", time.Date(2026, 1, 3, 3, 4, 5, 0, time.UTC)): time.Date(2026, 1, 3, 3, 4, 5, 0, time.UTC),
+		commit("/rocky/a.rpm", time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)):  time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	// committing a file doesn't change the modification time of another one
+	for p, mtime := range mtimes {
+		info, err := os.Stat(p)
+		require.NoError(t, err)
+		assert.True(t, mtime.Equal(info.ModTime()), p)
+	}
+	fedora := filepath.Join(baseDir, "fedora", "a.rpm")
+	assert.False(t, sameFile(t, fedora, filepath.Join(baseDir, "centos", "a.rpm")))
+	assert.True(t, sameFile(t, fedora, filepath.Join(baseDir, "rocky", "a.rpm")))
+}
+
+func TestListOrphanedBlobs(t *testing.T) {
+	baseDir := t.TempDir()
+	c := New(&CacheConfig{BasePath: baseDir, Deduplicate: true})
+
+	commitFile(t, c, "/repo/a.rpm", "content")
+	// simulate an interruption between removing the file and its blob
+	require.NoError(t, os.Remove(filepath.Join(baseDir, "repo", "a.rpm")))
+
+	orphaned, err := ListOrphanedBlobs(baseDir)
+	require.NoError(t, err)
+	require.Len(t, orphaned, 1)
+	assert.Equal(t, BlobDir, orphaned[0].Repository())
+	assert.Equal(t, blobs(t, baseDir)[0], orphaned[0].Path)
+	assert.WithinDuration(t, time.Now(), orphaned[0].ModTime, time.Minute)
+}
@@ -0,0 +1,367 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package cache
+
+import (
+	"container/list"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Evictor keeps track of the files stored below the cache base path and
+// removes the least recently used ones once the global quota or the quota
+// of a repository is exceeded. Files which are currently pinned (e.g. being
+// streamed to a client) are never evicted.
+//
+// A single Evictor is shared by the caches of all repositories so that the
+// global quota can be enforced. The first path element below the base path
+// is considered to be the repository name. Hardlinked (deduplicated) files
+// are counted once per repository and once towards the global quota.
+type Evictor struct {
+	basePath string
+	maxSize  int64
+
+	mu      sync.Mutex
+	limits  map[string]int64
+	lru     *list.List // front: most recently used
+	entries map[string]*list.Element
+	usage   map[string]int64
+	total   int64
+
+	// number of registered files by inode, globally and per repository
+	links     map[inode]int
+	repoLinks map[repoInode]int
+}
+
+type evictorEntry struct {
+	path   string
+	repo   string
+	size   int64
+	atime  time.Time
+	pinned int
+
+	inode    inode
+	hasInode bool
+}
+
+// repoInode is an inode referenced by the files of a repository.
+type repoInode struct {
+	repo  string
+	inode inode
+}
+
+// newEvictorEntry returns the entry of the file at path with the given info.
+func newEvictorEntry(path string, info fs.FileInfo, atime time.Time) *evictorEntry {
+	entry := &evictorEntry{path: path, size: info.Size(), atime: atime}
+	entry.inode, entry.hasInode = inodeOf(info)
+	return entry
+}
+
+// NewEvictor returns an Evictor for the given cache base path. A maxSize of
+// zero or less disables the global quota.
+func NewEvictor(basePath string, maxSize int64) *Evictor {
+	return &Evictor{
+		basePath:  filepath.Clean(basePath),
+		maxSize:   maxSize,
+		limits:    map[string]int64{},
+		lru:       list.New(),
+		entries:   map[string]*list.Element{},
+		usage:     map[string]int64{},
+		links:     map[inode]int{},
+		repoLinks: map[repoInode]int{},
+	}
+}
+
+// SetLimit sets the quota for the given repository. A maxSize of zero or
+// less disables the quota for the repository.
+func (e *Evictor) SetLimit(repo string, maxSize int64) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if maxSize > 0 {
+		e.limits[repo] = maxSize
+	} else {
+		delete(e.limits, repo)
+	}
+}
+
+// Enabled reports whether any quota is configured.
+func (e *Evictor) Enabled() bool {
+	if e == nil {
+		return false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.maxSize > 0 || len(e.limits) > 0
+}
+
+// Scan walks the cache base path and registers all cached files. The last
+// access time of files found on disk is initialized from their modification
+// time. Once the scan is complete, the quotas are enforced.
+func (e *Evictor) Scan() error {
+	if e == nil {
+		return nil
+	}
+	var found []*evictorEntry
+	err := filepath.WalkDir(e.basePath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() && isBlobDir(e.basePath, p) {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() || isTempFile(p) || isSidecarFile(p) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil //nolint:nilerr // file vanished during the scan
+		}
+		found = append(found, newEvictorEntry(p, info, info.ModTime()))
+		return nil
+	})
+
+	// Newest first, so that older files end up at the back of the list.
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].atime.After(found[j].atime)
+	})
+	e.mu.Lock()
+	for _, entry := range found {
+		if _, ok := e.entries[entry.path]; !ok {
+			e.insert(entry, false)
+		}
+	}
+	e.mu.Unlock()
+
+	e.Enforce()
+	return err
+}
+
+// Add registers a newly committed file of the given size and enforces the
+// quotas.
+func (e *Evictor) Add(path string, size int64) {
+	if e == nil {
+		return
+	}
+	path = filepath.Clean(path)
+	entry := &evictorEntry{path: path, size: size, atime: time.Now()}
+	if info, err := os.Stat(path); err == nil {
+		entry = newEvictorEntry(path, info, entry.atime)
+	}
+	e.mu.Lock()
+	if el, ok := e.entries[path]; ok {
+		e.remove(el)
+	}
+	e.insert(entry, true)
+	e.mu.Unlock()
+	e.Enforce()
+}
+
+// Pin records an access to the file at path and protects it from eviction
+// until the returned release function is called. Files which are not yet
+// known (e.g. created before the initial scan completed) are registered.
+func (e *Evictor) Pin(path string) func() {
+	if e == nil {
+		return func() {}
+	}
+	path = filepath.Clean(path)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	el, ok := e.entries[path]
+	if !ok {
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			return func() {}
+		}
+		el = e.insert(newEvictorEntry(path, info, time.Time{}), true)
+	}
+	entry := el.Value.(*evictorEntry)
+	entry.atime = time.Now()
+	entry.pinned++
+	e.lru.MoveToFront(el)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			e.mu.Lock()
+			defer e.mu.Unlock()
+			entry.pinned--
+		})
+	}
+}
+
+// Remove unregisters the file at path, e.g. after it has been deleted.
+func (e *Evictor) Remove(path string) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if el, ok := e.entries[filepath.Clean(path)]; ok {
+		e.remove(el)
+	}
+}
+
+// Usage returns the number of bytes used by the given repository.
+func (e *Evictor) Usage(repo string) int64 {
+	if e == nil {
+		return 0
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.usage[repo]
+}
+
+// TotalUsage returns the number of bytes used by all repositories.
+func (e *Evictor) TotalUsage() int64 {
+	if e == nil {
+		return 0
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.total
+}
+
+// Enforce evicts least recently used files until all quotas are met or only
+// pinned files remain.
+func (e *Evictor) Enforce() {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for repo, limit := range e.limits {
+		for e.usage[repo] > limit {
+			if !e.evictOne(repo) {
+				slog.Warn("cache quota exceeded but all files are in use", "repository", repo, "usage", e.usage[repo], "max_size", limit)
+				break
+			}
+		}
+	}
+	if e.maxSize > 0 {
+		for e.total > e.maxSize {
+			if !e.evictOne("") {
+				slog.Warn("cache quota exceeded but all files are in use", "usage", e.total, "max_size", e.maxSize)
+				break
+			}
+		}
+	}
+}
+
+// evictOne removes the least recently used unpinned file of the given
+// repository (or of any repository if repo is empty). It returns false if
+// no file could be evicted. The caller must hold e.mu.
+func (e *Evictor) evictOne(repo string) bool {
+	for el := e.lru.Back(); el != nil; el = el.Prev() {
+		entry := el.Value.(*evictorEntry)
+		if entry.pinned > 0 || (repo != "" && entry.repo != repo) {
+			continue
+		}
+		if err := removeFile(e.basePath, entry.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			slog.Error("cache evict failed", "path", entry.path, "error", err)
+			// forget the file anyway, otherwise we would retry it forever
+		} else {
+			slog.Info("cache evict", "path", entry.path, "bytes", entry.size, "last_access", entry.atime)
+		}
+		removeSidecar(entry.path)
+		e.remove(el)
+		return true
+	}
+	return false
+}
+
+// insert adds a new entry, either as most recently used (front) or as least
+// recently used (back) file. The caller must hold e.mu.
+func (e *Evictor) insert(entry *evictorEntry, front bool) *list.Element {
+	entry.repo = e.repoFromPath(entry.path)
+
+	var el *list.Element
+	if front {
+		el = e.lru.PushFront(entry)
+	} else {
+		el = e.lru.PushBack(entry)
+	}
+	e.entries[entry.path] = el
+	if e.link(entry, 1) {
+		e.usage[entry.repo] += entry.size
+	}
+	if e.linkGlobal(entry, 1) {
+		e.total += entry.size
+	}
+	return el
+}
+
+// remove drops an entry from the index. The caller must hold e.mu.
+func (e *Evictor) remove(el *list.Element) {
+	entry := e.lru.Remove(el).(*evictorEntry)
+	delete(e.entries, entry.path)
+	if e.link(entry, -1) {
+		e.usage[entry.repo] -= entry.size
+	}
+	if e.linkGlobal(entry, -1) {
+		e.total -= entry.size
+	}
+}
+
+// link adds delta to the number of files of the repository referencing the
+// inode of entry. It reports whether the size of the entry has to be added
+// to or removed from the repository usage, i.e. if it is the first or last
+// file referencing the inode. The caller must hold e.mu.
+func (e *Evictor) link(entry *evictorEntry, delta int) bool {
+	if !entry.hasInode {
+		return true
+	}
+	key := repoInode{repo: entry.repo, inode: entry.inode}
+	return countLink(e.repoLinks, key, delta)
+}
+
+// linkGlobal is like link, but for the global usage. The caller must hold
+// e.mu.
+func (e *Evictor) linkGlobal(entry *evictorEntry, delta int) bool {
+	if !entry.hasInode {
+		return true
+	}
+	return countLink(e.links, entry.inode, delta)
+}
+
+// countLink adds delta to the counter of key and reports whether it was
+// added first or removed last.
+func countLink[K comparable](counts map[K]int, key K, delta int) bool {
+	counts[key] += delta
+	n := counts[key]
+	if n <= 0 {
+		delete(counts, key)
+		return true
+	}
+	return delta > 0 && n == 1
+}
+
+// repoFromPath returns the first path element of path below the base path.
+func (e *Evictor) repoFromPath(path string) string {
+	rel, err := filepath.Rel(e.basePath, path)
+	if err != nil {
+		return ""
+	}
+	repo, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+	return repo
+}
+
+// isTempFile reports whether path is an in-progress download created by
+// CreateTempWriter.
+func isTempFile(path string) bool {
+	return strings.HasSuffix(path, ".tmp")
+}
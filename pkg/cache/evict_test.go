@@ -0,0 +1,124 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package cache
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// commitFile stores content for uri in the cache through the regular
+// temp file + commit path.
+func commitFile(t *testing.T, c FileCache, uri string, content string) {
+	t.Helper()
+	f, err := c.CreateTempWriter(uri)
+	require.NoError(t, err)
+	_, err = io.WriteString(f, content)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.NoError(t, c.CommitTempFile(f.Name(), uri, time.Now()))
+}
+
+func TestEvictorGlobalQuota(t *testing.T) {
+	baseDir := t.TempDir()
+	e := NewEvictor(baseDir, 10)
+	c := New(&CacheConfig{BasePath: baseDir, Evictor: e})
+
+	commitFile(t, c, "/repo/a.rpm", "aaaa")
+	commitFile(t, c, "/repo/b.rpm", "bbbb")
+	assert.Equal(t, int64(8), e.TotalUsage())
+
+	// Access a.rpm so that b.rpm becomes the least recently used file
+	c.Pin("/repo/a.rpm")()
+
+	commitFile(t, c, "/other/c.rpm", "cccc")
+	assert.True(t, c.IsCached("/repo/a.rpm"))
+	assert.False(t, c.IsCached("/repo/b.rpm"))
+	assert.True(t, c.IsCached("/other/c.rpm"))
+	assert.Equal(t, int64(8), e.TotalUsage())
+}
+
+func TestEvictorRepositoryQuota(t *testing.T) {
+	baseDir := t.TempDir()
+	e := NewEvictor(baseDir, 0)
+	e.SetLimit("small", 5)
+	c := New(&CacheConfig{BasePath: baseDir, Evictor: e})
+
+	commitFile(t, c, "/big/a.rpm", "aaaaaaaaaa")
+	commitFile(t, c, "/small/a.rpm", "aaaa")
+	commitFile(t, c, "/small/b.rpm", "bbbb")
+
+	assert.True(t, c.IsCached("/big/a.rpm"), "repository without quota must not be evicted")
+	assert.False(t, c.IsCached("/small/a.rpm"))
+	assert.True(t, c.IsCached("/small/b.rpm"))
+	assert.Equal(t, int64(4), e.Usage("small"))
+	assert.Equal(t, int64(10), e.Usage("big"))
+}
+
+func TestEvictorPinnedFileNotEvicted(t *testing.T) {
+	baseDir := t.TempDir()
+	e := NewEvictor(baseDir, 6)
+	c := New(&CacheConfig{BasePath: baseDir, Evictor: e})
+
+	commitFile(t, c, "/repo/a.rpm", "aaaa")
+	release := c.Pin("/repo/a.rpm")
+
+	// a.rpm is the oldest entry but pinned, the new file is evicted instead
+	commitFile(t, c, "/repo/b.rpm", "bbbb")
+	assert.True(t, c.IsCached("/repo/a.rpm"))
+	assert.False(t, c.IsCached("/repo/b.rpm"))
+
+	release()
+	commitFile(t, c, "/repo/c.rpm", "cccc")
+	assert.False(t, c.IsCached("/repo/a.rpm"))
+	assert.True(t, c.IsCached("/repo/c.rpm"))
+}
+
+func TestEvictorScan(t *testing.T) {
+	baseDir := t.TempDir()
+	old := filepath.Join(baseDir, "repo", "old.rpm")
+	recent := filepath.Join(baseDir, "repo", "recent.rpm")
+	tmp := filepath.Join(baseDir, "repo", "123.tmp")
+	require.NoError(t, os.MkdirAll(filepath.Dir(old), 0o750))
+	require.NoError(t, os.WriteFile(old, []byte("old-content"), 0o644))
+	require.NoError(t, os.WriteFile(recent, []byte("recent-content"), 0o644))
+	require.NoError(t, os.WriteFile(tmp, []byte("in-progress"), 0o644))
+	require.NoError(t, os.Chtimes(old, time.Now(), time.Now().Add(-48*time.Hour)))
+
+	e := NewEvictor(baseDir, 20)
+	require.NoError(t, e.Scan())
+
+	assert.NoFileExists(t, old)
+	assert.FileExists(t, recent)
+	assert.FileExists(t, tmp, "temp files must not be evicted")
+	assert.Equal(t, int64(len("recent-content")), e.TotalUsage())
+}
+
+func TestEvictorDeleteFileUpdatesUsage(t *testing.T) {
+	baseDir := t.TempDir()
+	e := NewEvictor(baseDir, 100)
+	c := New(&CacheConfig{BasePath: baseDir, Evictor: e})
+
+	commitFile(t, c, "/repo/a.rpm", "aaaa")
+	assert.Equal(t, int64(4), e.Usage("repo"))
+
+	require.NoError(t, c.DeleteFile("/repo/a.rpm"))
+	assert.Equal(t, int64(0), e.Usage("repo"))
+	assert.Equal(t, int64(0), e.TotalUsage())
+}
+
+func TestEvictorNil(t *testing.T) {
+	var e *Evictor
+	assert.False(t, e.Enabled())
+	assert.NoError(t, e.Scan())
+	e.Add("/some/path", 1)
+	e.Pin("/some/path")()
+	e.Remove("/some/path")
+	assert.Equal(t, int64(0), e.TotalUsage())
+}
@@ -0,0 +1,92 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Entry describes a file stored in the cache.
+type Entry struct {
+	// Request URI of the file, e.g. "/fedora/releases/42/.../kernel.rpm"
+	URI string `json:"uri"`
+
+	// Local file system path of the file
+	Path string `json:"-"`
+
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+}
+
+// Repository returns the repository name of the cached file.
+func (e *Entry) Repository() string {
+	return strings.SplitN(strings.TrimPrefix(e.URI, "/"), "/", 2)[0]
+}
+
+// List returns the files cached below basePath whose URI starts with prefix,
+// sorted by URI. Temp files and metadata sidecar files are skipped.
+func List(basePath string, prefix string) ([]Entry, error) {
+	return walk(basePath, prefix, func(p string) bool {
+		return !isTempFile(p) && !isSidecarFile(p)
+	})
+}
+
+// ListTemp returns the temp files below basePath which were left behind by
+// interrupted downloads, sorted by URI.
+func ListTemp(basePath string) ([]Entry, error) {
+	return walk(basePath, "/", isTempFile)
+}
+
+// walk returns the regular files below basePath whose URI starts with prefix
+// and for which include returns true.
+func walk(basePath string, prefix string, include func(string) bool) ([]Entry, error) {
+	base := filepath.Clean(basePath)
+	prefix = "/" + strings.TrimLeft(prefix, "/")
+	// only walk the directory containing the prefix
+	root := filepath.Join(base, filepath.FromSlash(path.Dir(prefix+"x")))
+	rel, err := filepath.Rel(base, root)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return nil, fmt.Errorf("prefix %q resolves outside the cache directory", prefix)
+	}
+
+	var entries []Entry
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() && p != root && isBlobDir(base, p) {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() || !include(p) {
+			return nil
+		}
+		rel, err := filepath.Rel(base, p)
+		if err != nil {
+			return err
+		}
+		uri := "/" + filepath.ToSlash(rel)
+		if !strings.HasPrefix(uri, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil //nolint:nilerr // file vanished during the walk
+		}
+		entries = append(entries, Entry{URI: uri, Path: p, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].URI < entries[j].URI
+	})
+	return entries, err
+}
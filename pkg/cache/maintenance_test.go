@@ -0,0 +1,58 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListAndListTemp(t *testing.T) {
+	baseDir := t.TempDir()
+	for _, name := range []string{
+		"repo/a/one.rpm",
+		"repo/a/one.rpm" + sidecarSuffix,
+		"repo/ab/two.rpm",
+		"repo/b/123.tmp",
+		"other/three.rpm",
+	} {
+		p := filepath.Join(baseDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o750))
+		require.NoError(t, os.WriteFile(p, []byte(name), 0o600))
+	}
+
+	entries, err := List(baseDir, "/")
+	require.NoError(t, err)
+	var uris []string
+	for _, e := range entries {
+		uris = append(uris, e.URI)
+	}
+	assert.Equal(t, []string{"/other/three.rpm", "/repo/a/one.rpm", "/repo/ab/two.rpm"}, uris)
+	assert.Equal(t, "repo", entries[1].Repository())
+
+	entries, err = List(baseDir, "/repo/a")
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "prefix matches partial directory names")
+
+	entries, err = List(baseDir, "/repo/a/")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, int64(len("repo/a/one.rpm")), entries[0].Size)
+
+	entries, err = List(baseDir, "/missing/")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	entries, err = List(baseDir, "/../")
+	require.NoError(t, err)
+	assert.Empty(t, entries, "prefix must not escape the cache directory")
+
+	entries, err = ListTemp(baseDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "/repo/b/123.tmp", entries[0].URI)
+}
@@ -0,0 +1,106 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+// sidecarSuffix is appended to the path of a cached file to store its
+// Metadata. URIs ending with this suffix are never cache candidates.
+const sidecarSuffix = ".pkgproxy.json"
+
+// Metadata holds auxiliary information about a cached file which is stored
+// in a sidecar file next to it.
+type Metadata struct {
+	// Entity tag returned by the upstream server
+	ETag string `json:"etag,omitempty"`
+
+	// Time when the file was last fetched or revalidated from upstream
+	Validated time.Time `json:"validated"`
+
+	// Checksum of the blob the file is linked to if it was deduplicated
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// GetMetadata returns the metadata stored for the cached file of the given
+// URI. If no metadata was stored, an empty Metadata is returned.
+func (c *cache) GetMetadata(uri string) (*Metadata, error) {
+	name, err := c.resolvedName(uri)
+	if err != nil {
+		return nil, err
+	}
+	f, err := c.storage.Open(sidecarName(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Metadata{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m := &Metadata{}
+	if err := json.NewDecoder(f).Decode(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SetMetadata atomically replaces the metadata stored for the cached file of
+// the given URI.
+func (c *cache) SetMetadata(uri string, m *Metadata) error {
+	name, err := c.resolvedName(uri)
+	if err != nil {
+		return err
+	}
+	return writeMetadata(c.storage, sidecarName(name), m)
+}
+
+// writeMetadata atomically replaces the sidecar file of the given name in the
+// storage.
+func writeMetadata(s Storage, name string, m *Metadata) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	tmpFile, err := s.CreateTemp(name)
+	if err != nil {
+		return err
+	}
+	tmpPath := tmpFile.Name()
+	_, err = tmpFile.Write(data)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = s.Commit(tmpPath, name, time.Now())
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+	}
+	return err
+}
+
+// sidecarName returns the name of the metadata file for the named file.
+func sidecarName(name string) string {
+	return name + sidecarSuffix
+}
+
+// sidecarPath returns the path of the metadata file for the cached file at p.
+func sidecarPath(p string) string {
+	return p + sidecarSuffix
+}
+
+// isSidecarFile reports whether path is a metadata sidecar file.
+func isSidecarFile(path string) bool {
+	return strings.HasSuffix(path, sidecarSuffix)
+}
+
+// removeSidecar removes the metadata file of the cached file at p, if any.
+func removeSidecar(p string) {
+	_ = os.Remove(sidecarPath(p))
+}
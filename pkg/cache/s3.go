@@ -0,0 +1,497 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package cache
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Payload hash of requests without body
+	s3EmptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	// Payload hash of uploads whose body is not part of the signature
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+	// Object metadata header holding the modification time of a cached file
+	s3MtimeHeader = "X-Amz-Meta-Mtime"
+
+	// Region used for signing if none is configured
+	defaultS3Region = "us-east-1"
+)
+
+var (
+	// Timeout for establishing a connection to the S3 endpoint
+	s3DialTimeout = 10 * time.Second
+
+	// Timeout for receiving the response headers from the S3 endpoint. The
+	// body of an object isn't limited, as it may be streamed to a slow
+	// client.
+	s3ResponseHeaderTimeout = 30 * time.Second
+)
+
+// S3Config defines an S3 compatible object storage holding the cached files.
+type S3Config struct {
+	// Base URL of the S3 API, e.g. "https://s3.eu-central-1.amazonaws.com".
+	// Objects are addressed path-style below the endpoint.
+	Endpoint string
+
+	// Region of the bucket used for signing the requests. Defaults to
+	// "us-east-1" if empty.
+	Region string
+
+	Bucket string
+
+	// Optional prefix prepended to the object keys, e.g. "pkgproxy/"
+	Prefix string
+
+	// Credentials used for signing the requests
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// Local file system path for the temp files of downloads in progress
+	TempPath string
+
+	// HTTP client used for all requests. A client with connect and response
+	// header timeouts is used if nil.
+	Client *http.Client
+}
+
+// S3Storage stores the cached files as objects in an S3 compatible bucket,
+// so that multiple pkgproxy instances can share the same cache. The
+// modification time of a file is stored as object metadata, the sidecar
+// files are stored as separate objects.
+type S3Storage struct {
+	endpoint *url.URL
+	region   string
+	bucket   string
+	prefix   string
+
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+
+	tempPath string
+	client   *http.Client
+
+	// Context of the requests, see WithContext
+	ctx context.Context
+}
+
+// NewS3Storage returns the storage for the given S3 configuration.
+func NewS3Storage(cfg *S3Config) (*S3Storage, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Bucket == "" {
+		return nil, errors.New("missing S3 bucket")
+	}
+	s := &S3Storage{
+		endpoint:        endpoint,
+		region:          cfg.Region,
+		bucket:          cfg.Bucket,
+		prefix:          strings.TrimLeft(cfg.Prefix, "/"),
+		accessKeyID:     cfg.AccessKeyID,
+		secretAccessKey: cfg.SecretAccessKey,
+		sessionToken:    cfg.SessionToken,
+		tempPath:        cfg.TempPath,
+		client:          cfg.Client,
+		ctx:             context.Background(),
+	}
+	if s.prefix != "" && !strings.HasSuffix(s.prefix, "/") {
+		s.prefix += "/"
+	}
+	if s.region == "" {
+		s.region = defaultS3Region
+	}
+	if s.client == nil {
+		s.client = newS3Client()
+	}
+	return s, nil
+}
+
+// newS3Client returns the default HTTP client of the S3 storage.
+func newS3Client() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: s3DialTimeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.ResponseHeaderTimeout = s3ResponseHeaderTimeout
+	return &http.Client{Transport: transport}
+}
+
+// WithContext returns a shallow copy of the storage sending its requests
+// with ctx, so that they are canceled together with the client request.
+func (s *S3Storage) WithContext(ctx context.Context) Storage {
+	clone := *s
+	clone.ctx = ctx
+	return &clone
+}
+
+func (s *S3Storage) CreateTemp(name string) (TempFile, error) {
+	return createTemp(s.tempPath, name)
+}
+
+func (s *S3Storage) Commit(tmpPath string, name string, mtime time.Time) error {
+	f, err := os.Open(tmpPath) //nolint:gosec // path was created by CreateTemp
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	header.Set(s3MtimeHeader, mtime.UTC().Format(time.RFC3339Nano))
+	var body io.Reader = http.NoBody
+	if info.Size() > 0 {
+		body = f
+	}
+	slog.Info("cache write", "bucket", s.bucket, "key", s.key(name), "bytes", info.Size())
+	rsp, err := s.do(http.MethodPut, s.key(name), nil, header, body, info.Size())
+	if err != nil {
+		return err
+	}
+	_ = rsp.Body.Close()
+	_ = f.Close()
+	return os.Remove(tmpPath)
+}
+
+func (s *S3Storage) Open(name string) (File, error) {
+	key := s.key(name)
+	info, etag, err := s.head(key)
+	if err != nil {
+		return nil, err
+	}
+	return &s3File{storage: s, key: key, info: info, etag: etag}, nil
+}
+
+func (s *S3Storage) Stat(name string) (fs.FileInfo, error) {
+	info, _, err := s.head(s.key(name))
+	return info, err
+}
+
+func (s *S3Storage) Remove(name string) error {
+	key := s.key(name)
+	slog.Info("cache delete", "bucket", s.bucket, "key", key)
+	for _, k := range []string{key, s.key(sidecarName(name))} {
+		rsp, err := s.do(http.MethodDelete, k, nil, nil, nil, 0)
+		if err != nil {
+			return err
+		}
+		_ = rsp.Body.Close()
+	}
+	return nil
+}
+
+// s3ListResult is the response of the ListObjectsV2 operation.
+type s3ListResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+		Size         int64     `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List returns the objects whose name starts with prefix. As the object
+// metadata isn't part of the listing, the modification time of the entries is
+// the time when the files were stored.
+func (s *S3Storage) List(prefix string) ([]Entry, error) {
+	var entries []Entry
+	query := url.Values{"list-type": {"2"}, "prefix": {s.key(prefix)}}
+	for {
+		rsp, err := s.do(http.MethodGet, "", query, nil, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		result := &s3ListResult{}
+		err = xml.NewDecoder(rsp.Body).Decode(result)
+		_ = rsp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3 list response: %w", err)
+		}
+		for _, object := range result.Contents {
+			name := strings.TrimPrefix(object.Key, s.prefix)
+			if isSidecarFile(name) || strings.HasSuffix(name, "/") {
+				continue
+			}
+			entries = append(entries, Entry{URI: "/" + name, Size: object.Size, ModTime: object.LastModified})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].URI < entries[j].URI
+	})
+	return entries, nil
+}
+
+// key returns the object key of the named file.
+func (s *S3Storage) key(name string) string {
+	return s.prefix + name
+}
+
+// head returns the file info and the entity tag of the object with the given
+// key.
+func (s *S3Storage) head(key string) (fs.FileInfo, string, error) {
+	rsp, err := s.do(http.MethodHead, key, nil, nil, nil, 0)
+	if err != nil {
+		return nil, "", err
+	}
+	_ = rsp.Body.Close()
+	info := &s3FileInfo{name: path.Base(key), size: rsp.ContentLength}
+	if mtime, err := time.Parse(time.RFC3339Nano, rsp.Header.Get(s3MtimeHeader)); err == nil {
+		info.mtime = mtime
+	} else if mtime, err := http.ParseTime(rsp.Header.Get("Last-Modified")); err == nil {
+		info.mtime = mtime
+	}
+	return info, rsp.Header.Get("Etag"), nil
+}
+
+// do sends a signed request for the object with the given key, or for the
+// bucket if key is empty. Responses other than 2xx are returned as error, a
+// 404 response as error wrapping fs.ErrNotExist.
+func (s *S3Storage) do(method string, key string, query url.Values, header http.Header, body io.Reader, size int64) (*http.Response, error) {
+	u := *s.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = s3Escape(u.Path, false)
+	u.RawQuery = s3CanonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(s.ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	payloadHash := s3EmptyPayloadHash
+	if body != nil {
+		req.ContentLength = size
+		payloadHash = s3UnsignedPayload
+	}
+	signV4(req, payloadHash, s.accessKeyID, s.secretAccessKey, s.sessionToken, s.region, time.Now())
+
+	rsp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode >= 200 && rsp.StatusCode < 300 {
+		return rsp, nil
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode == http.StatusNotFound {
+		return nil, &fs.PathError{Op: strings.ToLower(method), Path: key, Err: fs.ErrNotExist}
+	}
+	return nil, fmt.Errorf("S3 %s %s failed: %s%s", method, u.Path, rsp.Status, s3ErrorCode(rsp.Body))
+}
+
+// s3ErrorCode returns the error code of an S3 error response for inclusion
+// in an error message.
+func s3ErrorCode(r io.Reader) string {
+	var result struct {
+		Code string `xml:"Code"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(r, 4096)).Decode(&result); err != nil || result.Code == "" {
+		return ""
+	}
+	return " (" + result.Code + ")"
+}
+
+// s3File is a cached object opened for reading. The object is fetched
+// lazily from the current offset on the first read after a seek.
+type s3File struct {
+	storage *S3Storage
+	key     string
+	info    fs.FileInfo
+	etag    string
+
+	body   io.ReadCloser
+	offset int64
+}
+
+func (f *s3File) Read(b []byte) (int, error) {
+	if f.offset >= f.info.Size() {
+		return 0, io.EOF
+	}
+	if f.body == nil {
+		header := http.Header{}
+		header.Set("Range", fmt.Sprintf("bytes=%d-", f.offset))
+		if f.etag != "" {
+			// fail instead of mixing the data of two versions of the object
+			header.Set("If-Match", f.etag)
+		}
+		rsp, err := f.storage.do(http.MethodGet, f.key, nil, header, nil, 0)
+		if err != nil {
+			return 0, err
+		}
+		if rsp.StatusCode != http.StatusPartialContent && f.offset > 0 {
+			_ = rsp.Body.Close()
+			return 0, fmt.Errorf("S3 GET %s: range request not supported", f.key)
+		}
+		f.body = rsp.Body
+	}
+	n, err := f.body.Read(b)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *s3File) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.Size()
+	default:
+		return 0, errors.New("s3File.Seek: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("s3File.Seek: negative position")
+	}
+	if offset != f.offset && f.body != nil {
+		_ = f.body.Close()
+		f.body = nil
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *s3File) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *s3File) Close() error {
+	if f.body != nil {
+		return f.body.Close()
+	}
+	return nil
+}
+
+// s3FileInfo describes a cached object.
+type s3FileInfo struct {
+	name  string
+	size  int64
+	mtime time.Time
+}
+
+func (i *s3FileInfo) Name() string       { return i.name }
+func (i *s3FileInfo) Size() int64        { return i.size }
+func (i *s3FileInfo) Mode() fs.FileMode  { return 0o644 }
+func (i *s3FileInfo) ModTime() time.Time { return i.mtime }
+func (i *s3FileInfo) IsDir() bool        { return false }
+func (i *s3FileInfo) Sys() any           { return nil }
+
+// signV4 signs the request with AWS Signature Version 4 for the S3 service.
+// The host, range and all x-amz-* headers are signed.
+func signV4(req *http.Request, payloadHash string, accessKeyID string, secretAccessKey string, sessionToken string, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || name == "range" {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3Escape(req.URL.Path, false),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + secretAccessKey)
+	for _, data := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, data)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3CanonicalQuery returns the query string with sorted and escaped
+// parameters as required for signing.
+func s3CanonicalQuery(query url.Values) string {
+	params := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, s3Escape(name, true)+"="+s3Escape(value, true))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// s3Escape percent-encodes all bytes of s except the unreserved characters.
+// The "/" is kept unless escapeSlash is true.
+func s3Escape(s string, escapeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !escapeSlash) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,268 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrSnapshotExists is returned when a snapshot with the same name exists
+	ErrSnapshotExists = errors.New("snapshot already exists")
+
+	// ErrSnapshotNotFound is returned for unknown snapshots
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+
+	// ErrSnapshotEmpty is returned if there are no files to snapshot
+	ErrSnapshotEmpty = errors.New("no cached metadata to snapshot")
+
+	// snapshotNameRegexp defines which snapshot names are accepted
+	snapshotNameRegexp = regexp.MustCompile("^[a-zA-Z0-9][a-zA-Z0-9_.-]*$")
+)
+
+// Snapshot describes a named copy of the metadata of a repository.
+type Snapshot struct {
+	Repository string    `json:"repository"`
+	Name       string    `json:"name"`
+	Created    time.Time `json:"created"`
+	Files      int       `json:"files"`
+	Size       int64     `json:"size"`
+}
+
+// SnapshotStore keeps named copies of the cached metadata of a repository.
+// The files of a snapshot are stored below "<base>/<repository>/<name>/" with
+// the same relative paths as in the cache and are never modified after the
+// snapshot was created.
+type SnapshotStore struct {
+	basePath string
+}
+
+// NewSnapshotStore returns a snapshot store below the given base path.
+func NewSnapshotStore(basePath string) *SnapshotStore {
+	return &SnapshotStore{basePath: basePath}
+}
+
+// ValidSnapshotName reports whether name can be used as snapshot name.
+func ValidSnapshotName(name string) bool {
+	return snapshotNameRegexp.MatchString(name)
+}
+
+// dir returns the directory of the named snapshot.
+func (s *SnapshotStore) dir(repo string, name string) (string, error) {
+	if !ValidSnapshotName(name) || repo == "" || strings.ContainsAny(repo, `/\`) || strings.HasPrefix(repo, ".") {
+		return "", fmt.Errorf("invalid snapshot '%s@%s'", repo, name)
+	}
+	return filepath.Join(s.basePath, repo, name), nil
+}
+
+// Create copies the metadata files of repo from the cache into a new
+// snapshot. The snapshot only becomes visible once all files were copied.
+func (s *SnapshotStore) Create(fc FileCache, repo string, name string) (*Snapshot, error) {
+	dir, err := s.dir(repo, name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return nil, ErrSnapshotExists
+	}
+	entries, err := fc.List("/" + repo + "/")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0o750); err != nil {
+		return nil, err
+	}
+	tmpDir, err := os.MkdirTemp(filepath.Dir(dir), "."+name+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	copied := 0
+	for _, entry := range entries {
+		if !fc.IsMetadata(entry.URI) {
+			continue
+		}
+		rel := strings.TrimPrefix(entry.URI, "/"+repo+"/")
+		if err := copyFile(fc, entry.URI, filepath.Join(tmpDir, filepath.FromSlash(rel))); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				// evicted during the copy
+				continue
+			}
+			return nil, err
+		}
+		copied++
+	}
+	if copied == 0 {
+		return nil, ErrSnapshotEmpty
+	}
+	now := time.Now()
+	if err := os.Chtimes(tmpDir, now, now); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmpDir, dir); err != nil {
+		if _, statErr := os.Stat(dir); statErr == nil {
+			return nil, ErrSnapshotExists
+		}
+		return nil, err
+	}
+	return s.Get(repo, name)
+}
+
+// Get returns the named snapshot of repo.
+func (s *SnapshotStore) Get(repo string, name string) (*Snapshot, error) {
+	dir, err := s.dir(repo, name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(dir)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && !info.IsDir()) {
+		return nil, ErrSnapshotNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries, err := walk(dir, "/", func(string) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &Snapshot{Repository: repo, Name: name, Created: info.ModTime(), Files: len(entries)}
+	for _, entry := range entries {
+		snapshot.Size += entry.Size
+	}
+	return snapshot, nil
+}
+
+// Exists reports whether the named snapshot of repo exists.
+func (s *SnapshotStore) Exists(repo string, name string) bool {
+	dir, err := s.dir(repo, name)
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(dir)
+	return err == nil && info.IsDir()
+}
+
+// List returns the snapshots of repo sorted by name, or the snapshots of all
+// repositories if repo is empty.
+func (s *SnapshotStore) List(repo string) ([]Snapshot, error) {
+	repos := []string{repo}
+	if repo == "" {
+		var err error
+		if repos, err = readDirNames(s.basePath); err != nil {
+			return nil, err
+		}
+	}
+	snapshots := []Snapshot{}
+	for _, r := range repos {
+		names, err := readDirNames(filepath.Join(s.basePath, r))
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			snapshot, err := s.Get(r, name)
+			if err != nil {
+				continue
+			}
+			snapshots = append(snapshots, *snapshot)
+		}
+	}
+	return snapshots, nil
+}
+
+// Delete removes the named snapshot of repo.
+func (s *SnapshotStore) Delete(repo string, name string) error {
+	dir, err := s.dir(repo, name)
+	if err != nil {
+		return err
+	}
+	if !s.Exists(repo, name) {
+		return ErrSnapshotNotFound
+	}
+	return os.RemoveAll(dir)
+}
+
+// GetFilePath returns the file system path of uri in the named snapshot of
+// repo. The URI is relative to the repository, e.g. "/fedora/.../repomd.xml".
+// If the snapshot doesn't contain the file, fs.ErrNotExist is returned.
+func (s *SnapshotStore) GetFilePath(repo string, name string, uri string) (string, error) {
+	dir, err := s.dir(repo, name)
+	if err != nil {
+		return "", err
+	}
+	rel, ok := strings.CutPrefix(uri, "/"+repo+"/")
+	if !ok {
+		return "", fmt.Errorf("URI %q is not part of repository '%s'", uri, repo)
+	}
+	p := filepath.Clean(filepath.Join(dir, strings.TrimLeft(rel, "/")))
+	if r, err := filepath.Rel(dir, p); err != nil || strings.HasPrefix(r, "..") {
+		return "", fmt.Errorf("URI %q resolves outside the snapshot directory", uri)
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", fs.ErrNotExist
+	}
+	return p, nil
+}
+
+// readDirNames returns the sorted names of the directories in dir, skipping
+// hidden ones. A missing directory has no entries.
+func readDirNames(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// copyFile copies the cached file for uri to dst including its modification
+// time, creating the parent directories of dst.
+func copyFile(fc FileCache, uri string, dst string) error {
+	in, err := fc.Open(uri)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o750); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600) //nolint:gosec // path is below the snapshot directory
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, time.Now(), info.ModTime())
+}
@@ -0,0 +1,75 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package cache
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotStore(t *testing.T) {
+	cacheDir := t.TempDir()
+	for _, name := range []string{
+		"repo/os/repodata/repomd.xml",
+		"repo/os/repodata/repomd.xml" + sidecarSuffix,
+		"repo/os/Packages/a.rpm",
+		"other/os/repodata/repomd.xml",
+	} {
+		p := filepath.Join(cacheDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o750))
+		require.NoError(t, os.WriteFile(p, []byte(name), 0o600))
+	}
+	fc := New(&CacheConfig{BasePath: cacheDir, Metadata: []string{"repomd.xml"}})
+	store := NewSnapshotStore(t.TempDir())
+
+	snapshot, err := store.Create(fc, "repo", "2026-10-01")
+	require.NoError(t, err)
+	assert.Equal(t, "repo", snapshot.Repository)
+	assert.Equal(t, "2026-10-01", snapshot.Name)
+	assert.Equal(t, 1, snapshot.Files)
+	assert.Equal(t, int64(len("repo/os/repodata/repomd.xml")), snapshot.Size)
+
+	_, err = store.Create(fc, "repo", "2026-10-01")
+	assert.ErrorIs(t, err, ErrSnapshotExists)
+	_, err = store.Create(fc, "missing", "2026-10-01")
+	assert.ErrorIs(t, err, ErrSnapshotEmpty)
+	_, err = store.Create(fc, "repo", "../escape")
+	assert.Error(t, err)
+
+	// the snapshot is not affected by changes to the cache
+	require.NoError(t, os.WriteFile(filepath.Join(cacheDir, "repo", "os", "repodata", "repomd.xml"), []byte("new"), 0o600))
+	p, err := store.GetFilePath("repo", "2026-10-01", "/repo/os/repodata/repomd.xml")
+	require.NoError(t, err)
+	content, err := os.ReadFile(p) //nolint:gosec
+	require.NoError(t, err)
+	assert.Equal(t, "repo/os/repodata/repomd.xml", string(content))
+
+	_, err = store.GetFilePath("repo", "2026-10-01", "/repo/os/Packages/a.rpm")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = store.GetFilePath("repo", "2026-10-01", "/repo/../../other/os/repodata/repomd.xml")
+	assert.Error(t, err)
+
+	_, err = store.Create(fc, "other", "base")
+	require.NoError(t, err)
+	snapshots, err := store.List("")
+	require.NoError(t, err)
+	require.Len(t, snapshots, 2)
+	assert.Equal(t, "other", snapshots[0].Repository)
+	assert.Equal(t, "repo", snapshots[1].Repository)
+	snapshots, err = store.List("repo")
+	require.NoError(t, err)
+	assert.Len(t, snapshots, 1)
+
+	require.NoError(t, store.Delete("repo", "2026-10-01"))
+	assert.ErrorIs(t, store.Delete("repo", "2026-10-01"), ErrSnapshotNotFound)
+	_, err = store.Get("repo", "2026-10-01")
+	assert.ErrorIs(t, err, ErrSnapshotNotFound)
+	snapshots, err = store.List("repo")
+	require.NoError(t, err)
+	assert.Empty(t, snapshots)
+}
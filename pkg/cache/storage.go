@@ -0,0 +1,161 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package cache
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Storage is the backend holding the cached files. Names are slash separated
+// paths relative to the root of the storage without leading slash, e.g.
+// "fedora/releases/42/Everything/x86_64/os/Packages/k/kernel.rpm". Metadata
+// is stored in a sidecar file next to the cached file.
+//
+// Temp files are always created on the local file system, so that concurrent
+// requests can read a file while it is being downloaded.
+type Storage interface {
+	// Create a temp file for writing a new version of the named file. The
+	// caller is responsible for closing the returned file.
+	CreateTemp(name string) (TempFile, error)
+
+	// Atomically replace the named file with the content of the closed temp
+	// file at tmpPath and set its modification time. The temp file is
+	// consumed on success.
+	Commit(tmpPath string, name string, mtime time.Time) error
+
+	// Open the named file for reading. Missing files are reported with an
+	// error wrapping fs.ErrNotExist.
+	Open(name string) (File, error)
+
+	// Return the file info of the named file. Missing files are reported with
+	// an error wrapping fs.ErrNotExist.
+	Stat(name string) (fs.FileInfo, error)
+
+	// Remove the named file including its sidecar file
+	Remove(name string) error
+
+	// Return the files whose name starts with prefix, sorted by URI. Temp
+	// files and sidecar files are skipped.
+	List(prefix string) ([]Entry, error)
+}
+
+// TempFile is a file which is being written to the cache.
+type TempFile interface {
+	io.WriteCloser
+
+	// Local file system path of the temp file. It can be opened for reading
+	// while data is written to it.
+	Name() string
+}
+
+// File is a cached file opened for reading.
+type File interface {
+	io.ReadSeekCloser
+	Stat() (fs.FileInfo, error)
+}
+
+// localStorage stores the cached files below the base path of the cache
+// configuration. It takes care of the quota bookkeeping and the deduplication
+// of the committed files.
+type localStorage struct {
+	config *CacheConfig
+}
+
+// path returns the local file system path of the named file.
+func (s *localStorage) path(name string) string {
+	return filepath.Join(filepath.Clean(s.config.BasePath), filepath.FromSlash(name))
+}
+
+func (s *localStorage) CreateTemp(name string) (TempFile, error) {
+	return createTemp(s.config.BasePath, name)
+}
+
+func (s *localStorage) Commit(tmpPath string, name string, mtime time.Time) error {
+	filePath := s.path(name)
+
+	if err := os.Chtimes(tmpPath, time.Now().Local(), mtime); err != nil {
+		return err
+	}
+	info, err := os.Stat(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	if isSidecarFile(name) {
+		return os.Rename(tmpPath, filePath)
+	}
+
+	var sum string
+	if s.config.Deduplicate && !isMetadata(s.config.Metadata, name) {
+		if sum, err = s.dedup(tmpPath, info); err != nil {
+			// store the file without deduplication
+			slog.Warn("cache dedup failed", "path", filePath, "error", err)
+		}
+	}
+
+	previous := blobChecksum(filePath)
+	slog.Info("cache write", "path", filePath, "bytes", info.Size())
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return err
+	}
+	if sum != "" {
+		if err := writeMetadata(s, sidecarName(name), &Metadata{SHA256: sum}); err != nil {
+			slog.Warn("cache dedup failed", "path", filePath, "error", err)
+		}
+	} else if previous != "" {
+		removeSidecar(filePath)
+	}
+	if previous != "" && previous != sum {
+		releaseBlob(s.config.BasePath, previous)
+	}
+	s.config.Evictor.Add(filePath, info.Size())
+	return nil
+}
+
+func (s *localStorage) Open(name string) (File, error) {
+	f, err := os.Open(s.path(name))
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *localStorage) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(s.path(name))
+}
+
+func (s *localStorage) Remove(name string) error {
+	p := s.path(name)
+	slog.Info("cache delete", "path", p)
+	if err := removeFile(s.config.BasePath, p); err != nil {
+		return err
+	}
+	s.config.Evictor.Remove(p)
+	return nil
+}
+
+func (s *localStorage) List(prefix string) ([]Entry, error) {
+	return List(s.config.BasePath, "/"+prefix)
+}
+
+// createTemp creates a temp file for the named file in the corresponding
+// directory below basePath, creating parent directories as needed.
+func createTemp(basePath string, name string) (TempFile, error) {
+	dir := filepath.Dir(filepath.Join(filepath.Clean(basePath), filepath.FromSlash(name)))
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.CreateTemp(dir, "*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
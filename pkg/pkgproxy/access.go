@@ -0,0 +1,156 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package pkgproxy
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	echo "github.com/labstack/echo/v5"
+)
+
+// accessControl holds the resolved client access rules of a repository.
+type accessControl struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+
+	// Clients must authenticate with one of the credentials if set
+	requireAuth bool
+	users       map[string]string
+	tokens      []string
+}
+
+// newAccessControl parses the networks and resolves the secrets of config.
+func newAccessControl(config *AccessConfig) (*accessControl, error) {
+	ac := &accessControl{
+		requireAuth: len(config.Users) > 0 || len(config.Tokens) > 0,
+		users:       map[string]string{},
+	}
+	for key, values := range map[string][]string{"allow": config.Allow, "deny": config.Deny} {
+		for _, value := range values {
+			ipNet, err := ParseNetwork(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			if key == "allow" {
+				ac.allow = append(ac.allow, ipNet)
+			} else {
+				ac.deny = append(ac.deny, ipNet)
+			}
+		}
+	}
+	for user, secret := range config.Users {
+		password, err := secret.value()
+		if err != nil {
+			return nil, fmt.Errorf("user %s: %w", user, err)
+		}
+		ac.users[user] = password
+	}
+	for i, secret := range config.Tokens {
+		token, err := secret.value()
+		if err != nil {
+			return nil, fmt.Errorf("token %d: %w", i, err)
+		}
+		ac.tokens = append(ac.tokens, token)
+	}
+	return ac, nil
+}
+
+// ParseNetwork parses a CIDR or an IP address, which is treated as network of
+// a single host.
+func ParseNetwork(value string) (*net.IPNet, error) {
+	if _, ipNet, err := net.ParseCIDR(value); err == nil {
+		return ipNet, nil
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid CIDR or IP address %q", value)
+	}
+	bits := 128
+	if ip.To4() != nil {
+		ip = ip.To4()
+		bits = 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// allowed reports whether a client with the given IP address may access the
+// repository. Deny rules take precedence, a non-empty allow list must contain
+// the address.
+func (ac *accessControl) allowed(ip net.IP) bool {
+	if ip == nil {
+		return len(ac.allow) == 0 && len(ac.deny) == 0
+	}
+	for _, ipNet := range ac.deny {
+		if ipNet.Contains(ip) {
+			return false
+		}
+	}
+	if len(ac.allow) == 0 {
+		return true
+	}
+	for _, ipNet := range ac.allow {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticated reports whether the request carries valid client
+// credentials. All requests are authenticated if no credentials are
+// configured.
+func (ac *accessControl) authenticated(req *http.Request) bool {
+	if !ac.requireAuth {
+		return true
+	}
+	if user, password, ok := req.BasicAuth(); ok {
+		expected, found := ac.users[user]
+		return found && subtle.ConstantTimeCompare([]byte(password), []byte(expected)) == 1
+	}
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	for _, expected := range ac.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAccess enforces the access control of the requested repository. It
+// returns true if the request was rejected and the error response has been
+// written. The client credentials are removed from the request, so that they
+// are never forwarded to the mirrors.
+func (pp *pkgProxy) checkAccess(c *echo.Context) (bool, error) {
+	req := c.Request()
+	if !pp.isRepositoryRequest(req.RequestURI) {
+		return false, nil
+	}
+	repo := getRepoFromURI(req.RequestURI)
+	ac := pp.upstreams[repo].access
+	if ac == nil {
+		return false, nil
+	}
+	if !ac.allowed(net.ParseIP(c.RealIP())) {
+		slog.Warn("client access denied", "request_id", requestID(c), "repository", repo, "remote_ip", c.RealIP())
+		return true, c.JSON(http.StatusForbidden, map[string]string{jsonKeyMessage: "Forbidden"})
+	}
+	// The admin token authenticates DELETE requests in place of the client
+	// credentials, the networks still apply.
+	if !ac.authenticated(req) && (req.Method != httpMethodDelete || !pp.deleteAuth.hasToken(req.Header.Get("Authorization"))) {
+		slog.Warn("client authentication failed", "request_id", requestID(c), "repository", repo, "remote_ip", c.RealIP())
+		c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="pkgproxy"`)
+		return true, c.JSON(http.StatusUnauthorized, map[string]string{jsonKeyMessage: "Unauthorized"})
+	}
+	if ac.requireAuth {
+		req.Header.Del("Authorization")
+	}
+	return false, nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package pkgproxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessControlNetworks(t *testing.T) {
+	mirror, count := countingServer(t, "package", nil)
+	pp, cacheDir := newTestProxyWithRepo(t, Repository{
+		Access: &AccessConfig{
+			Allow: []string{"10.0.0.0/8", "192.0.2.1"},
+			Deny:  []string{"10.1.0.0/16"},
+		},
+		Mirrors: []string{mirror.URL + "/"},
+	})
+	app := newTestApp(pp)
+
+	get := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/testrepo/Packages/a.rpm", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		return rec
+	}
+	for _, remoteAddr := range []string{"10.1.2.3:1234", "192.0.2.2:1234", "[2001:db8::1]:1234"} {
+		rec := get(remoteAddr)
+		assert.Equal(t, http.StatusForbidden, rec.Code, remoteAddr)
+		assert.JSONEq(t, `{"message":"Forbidden"}`, rec.Body.String())
+	}
+	assert.Equal(t, int32(0), count.Load(), "rejected requests must not be fetched")
+	assert.NoFileExists(t, filepath.Join(cacheDir, "testrepo", "Packages", "a.rpm"))
+
+	assert.Equal(t, http.StatusOK, get("10.2.3.4:1234").Code)
+	assert.Equal(t, http.StatusOK, get("192.0.2.1:1234").Code)
+	assert.Equal(t, int32(1), count.Load())
+
+	// cached files are protected as well
+	assert.Equal(t, http.StatusForbidden, get("10.1.2.3:1234").Code)
+}
+
+func TestAccessControlCredentials(t *testing.T) {
+	t.Setenv("TEST_CLIENT_TOKEN", "client-token")
+	mirror := &headerRecorder{}
+	server := httptest.NewServer(mirror)
+	defer server.Close()
+	pp, _ := newTestProxyWithRepo(t, Repository{
+		Access: &AccessConfig{
+			Users:  map[string]Secret{"ci": {File: writeSecret(t, "password\n")}},
+			Tokens: []Secret{{Env: "TEST_CLIENT_TOKEN"}},
+		},
+		Mirrors: []string{server.URL + "/"},
+	})
+	app := newTestApp(pp)
+
+	get := func(set func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/testrepo/Packages/a.rpm", nil)
+		if set != nil {
+			set(req)
+		}
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		return rec
+	}
+	rec := get(nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, `Basic realm="pkgproxy"`, rec.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, http.StatusUnauthorized, get(func(r *http.Request) { r.SetBasicAuth("ci", "wrong") }).Code)
+	assert.Equal(t, http.StatusUnauthorized, get(func(r *http.Request) { r.SetBasicAuth("other", "password") }).Code)
+	assert.Equal(t, http.StatusUnauthorized, get(func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong") }).Code)
+
+	assert.Equal(t, http.StatusOK, get(func(r *http.Request) { r.SetBasicAuth("ci", "password") }).Code)
+	assert.Empty(t, mirror.get("Authorization"), "client credentials must not be forwarded")
+	assert.Equal(t, http.StatusOK, get(func(r *http.Request) { r.Header.Set("Authorization", "Bearer client-token") }).Code)
+}
+
+func TestAccessControlSnapshot(t *testing.T) {
+	pp, _ := newTestProxyWithRepo(t, Repository{
+		Access:  &AccessConfig{Allow: []string{"10.0.0.0/8"}},
+		Mirrors: []string{"http://127.0.0.1:1/"},
+	})
+	rec := httptest.NewRecorder()
+	newTestApp(pp).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/testrepo@2026-10-01/repodata/repomd.xml", nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestAccessControlAllowed(t *testing.T) {
+	ac, err := newAccessControl(&AccessConfig{Allow: []string{"2001:db8::/32"}, Deny: []string{"2001:db8::1"}})
+	require.NoError(t, err)
+	assert.True(t, ac.allowed(net.ParseIP("2001:db8::2")))
+	assert.False(t, ac.allowed(net.ParseIP("2001:db8::1")))
+	assert.False(t, ac.allowed(net.ParseIP("192.0.2.1")))
+	assert.False(t, ac.allowed(nil))
+
+	ac, err = newAccessControl(&AccessConfig{})
+	require.NoError(t, err)
+	assert.True(t, ac.allowed(net.ParseIP("192.0.2.1")))
+}
+
+func TestValidateConfigAccess(t *testing.T) {
+	for name, access := range map[string]*AccessConfig{
+		"invalid allow":  {Allow: []string{"10.0.0.0/33"}},
+		"invalid deny":   {Deny: []string{"example.com"}},
+		"missing secret": {Tokens: []Secret{{Env: "TEST_CLIENT_TOKEN_MISSING"}}},
+	} {
+		config := &RepoConfig{Repositories: map[string]Repository{
+			"fedora": {Access: access, CacheSuffixes: []string{".rpm"}, Mirrors: []string{"https://example.com/"}},
+		}}
+		assert.Error(t, validateConfig(config), name)
+	}
+}
@@ -0,0 +1,351 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package pkgproxy
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/ganto/pkgproxy/pkg/cache"
+	"github.com/ganto/pkgproxy/pkg/utils"
+	echo "github.com/labstack/echo/v5"
+)
+
+// AdminPrefix is the route prefix of the admin API. It is reserved and cannot
+// be used as repository name.
+const AdminPrefix = "/_admin"
+
+// Prefetch states reported by the admin API
+const (
+	prefetchStarted    = "started"
+	prefetchCached     = "cached"
+	prefetchInProgress = "in progress"
+	prefetchNotCached  = "not cacheable"
+	prefetchOffline    = "offline"
+)
+
+type (
+	adminRepository struct {
+		Name    string   `json:"name"`
+		Mirrors []string `json:"mirrors"`
+		Files   int      `json:"files"`
+		Size    int64    `json:"size"`
+	}
+
+	adminUsage struct {
+		Total        int64            `json:"total"`
+		Repositories map[string]int64 `json:"repositories"`
+	}
+
+	adminPurgeResult struct {
+		Deleted int   `json:"deleted"`
+		Size    int64 `json:"size"`
+	}
+
+	adminPrefetchRequest struct {
+		Paths []string `json:"paths"`
+	}
+
+	adminPrefetchResult struct {
+		Path   string `json:"path"`
+		Status string `json:"status"`
+	}
+
+	adminSnapshotRequest struct {
+		Name string `json:"name"`
+	}
+)
+
+// AdminAuth returns a middleware which only lets requests pass that carry the
+// given token as bearer token in the Authorization header.
+func AdminAuth(token string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			auth := c.Request().Header.Get("Authorization")
+			given, ok := strings.CutPrefix(auth, "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				c.Response().Header().Set("WWW-Authenticate", `Bearer realm="pkgproxy"`)
+				return c.JSON(http.StatusUnauthorized, map[string]string{jsonKeyMessage: "Unauthorized"})
+			}
+			return next(c)
+		}
+	}
+}
+
+// Admin registers the admin API handlers on the given group.
+func (pp *pkgProxy) Admin(g *echo.Group) {
+	g.GET("/repositories", pp.adminListRepositories)
+	g.GET("/repositories/:repo/files", pp.adminListFiles)
+	g.DELETE("/repositories/:repo/files", pp.adminPurge)
+	g.POST("/repositories/:repo/prefetch", pp.adminPrefetch)
+	g.GET("/repositories/:repo/snapshots", pp.adminListSnapshots)
+	g.POST("/repositories/:repo/snapshots", pp.adminCreateSnapshot)
+	g.DELETE("/repositories/:repo/snapshots/:name", pp.adminDeleteSnapshot)
+	g.GET("/mirrors", pp.adminMirrors)
+	g.GET("/usage", pp.adminUsage)
+}
+
+func (pp *pkgProxy) adminListRepositories(c *echo.Context) error {
+	repos := map[string]*adminRepository{}
+	for name, upstream := range pp.upstreams {
+		mirrors := []string{}
+		for _, mirror := range pp.mirrorList(name) {
+			mirrors = append(mirrors, mirror.String())
+		}
+		repo := &adminRepository{Name: name, Mirrors: mirrors}
+		entries, err := upstream.cache.List("/" + name + "/")
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{jsonKeyMessage: err.Error()})
+		}
+		for _, entry := range entries {
+			repo.Files++
+			repo.Size += entry.Size
+		}
+		repos[name] = repo
+	}
+	result := []*adminRepository{}
+	for _, name := range utils.KeysFromMap(repos) {
+		result = append(result, repos[name])
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+func (pp *pkgProxy) adminListFiles(c *echo.Context) error {
+	repo := c.Param("repo")
+	upstream, ok := pp.upstreams[repo]
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{jsonKeyMessage: "Unknown repository"})
+	}
+	prefix, ok := repositoryPrefix(repo, c.QueryParam("prefix"))
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{jsonKeyMessage: "Invalid prefix"})
+	}
+	entries, err := upstream.cache.List(prefix)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{jsonKeyMessage: err.Error()})
+	}
+	if entries == nil {
+		entries = []cache.Entry{}
+	}
+	return c.JSON(http.StatusOK, entries)
+}
+
+// adminPurge removes the cached files of a repository matching the prefix
+// and/or glob query parameters. A glob without "/" is matched against the
+// file name, otherwise against the path relative to the repository.
+func (pp *pkgProxy) adminPurge(c *echo.Context) error {
+	repo := c.Param("repo")
+	upstream, ok := pp.upstreams[repo]
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{jsonKeyMessage: "Unknown repository"})
+	}
+	prefix := c.QueryParam("prefix")
+	glob := c.QueryParam("glob")
+	if prefix == "" && glob == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{jsonKeyMessage: "Missing prefix or glob"})
+	}
+	if _, err := path.Match(glob, ""); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{jsonKeyMessage: "Invalid glob pattern"})
+	}
+	repoPrefix, ok := repositoryPrefix(repo, prefix)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{jsonKeyMessage: "Invalid prefix"})
+	}
+
+	entries, err := upstream.cache.List(repoPrefix)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{jsonKeyMessage: err.Error()})
+	}
+	result := adminPurgeResult{}
+	for _, entry := range entries {
+		if glob != "" && !matchGlob(glob, strings.TrimPrefix(entry.URI, "/"+repo+"/")) {
+			continue
+		}
+		if err := upstream.cache.DeleteFile(entry.URI); err != nil {
+			slog.Error("cache purge failed", "request_id", requestID(c), "uri", entry.URI, "error", err)
+			continue
+		}
+		result.Deleted++
+		result.Size += entry.Size
+	}
+	slog.Info("cache purge", "request_id", requestID(c), "repository", repo, "prefix", prefix, "glob", glob, "deleted", result.Deleted,
+		"remote_ip", c.RealIP(), "authorized_by", deleteByToken)
+	return c.JSON(http.StatusOK, result)
+}
+
+// repositoryPrefix joins the prefix query parameter to the repository path.
+// It returns false if the prefix resolves outside of the repository.
+func repositoryPrefix(repo string, prefix string) (string, bool) {
+	joined := path.Join("/", repo, prefix)
+	return joined, joined == "/"+repo || strings.HasPrefix(joined, "/"+repo+"/")
+}
+
+// matchGlob matches the pattern against the file name if it contains no
+// "/", otherwise against the full relative path.
+func matchGlob(pattern string, relPath string) bool {
+	if !strings.Contains(pattern, "/") {
+		relPath = path.Base(relPath)
+	}
+	ok, _ := path.Match(pattern, relPath)
+	return ok
+}
+
+func (pp *pkgProxy) adminUsage(c *echo.Context) error {
+	usage := adminUsage{Repositories: map[string]int64{}}
+	for name, upstream := range pp.upstreams {
+		entries, err := upstream.cache.List("/" + name + "/")
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{jsonKeyMessage: err.Error()})
+		}
+		usage.Repositories[name] = 0
+		for _, entry := range entries {
+			usage.Repositories[name] += entry.Size
+			usage.Total += entry.Size
+		}
+	}
+	return c.JSON(http.StatusOK, usage)
+}
+
+// adminMirrors reports the health of the mirrors of all repositories.
+func (pp *pkgProxy) adminMirrors(c *echo.Context) error {
+	result := map[string][]mirrorStatus{}
+	for name, upstream := range pp.upstreams {
+		mirrors := []mirrorStatus{}
+		if upstream.parent != nil {
+			mirrors = append(mirrors, upstream.health.get(upstream.parent).status(upstream.parent.String()))
+		}
+		for _, mirror := range pp.mirrorList(name) {
+			mirrors = append(mirrors, upstream.health.get(mirror).status(mirror.String()))
+		}
+		result[name] = mirrors
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// adminPrefetch starts background downloads of the given paths of a
+// repository into the cache.
+func (pp *pkgProxy) adminPrefetch(c *echo.Context) error {
+	repo := c.Param("repo")
+	if _, ok := pp.upstreams[repo]; !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{jsonKeyMessage: "Unknown repository"})
+	}
+	var body adminPrefetchRequest
+	if err := c.Bind(&body); err != nil || len(body.Paths) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{jsonKeyMessage: "Expected JSON object with list of paths"})
+	}
+
+	// all paths are checked before anything is fetched
+	uris := make([]string, 0, len(body.Paths))
+	for _, p := range body.Paths {
+		uri, ok := repositoryPrefix(repo, p)
+		if !ok || uri == "/"+repo {
+			return c.JSON(http.StatusBadRequest, map[string]string{jsonKeyMessage: "Invalid path"})
+		}
+		uris = append(uris, uri)
+	}
+
+	results := []adminPrefetchResult{}
+	for i, uri := range uris {
+		results = append(results, adminPrefetchResult{Path: body.Paths[i], Status: pp.prefetch(requestID(c), repo, uri)})
+	}
+	return c.JSON(http.StatusAccepted, results)
+}
+
+// prefetch starts fetching uri into the cache in the background unless it is
+// already cached or being downloaded.
+func (pp *pkgProxy) prefetch(rid string, repo string, uri string) string {
+	fc := pp.upstreams[repo].cache
+	if !fc.IsCacheCandidate(uri) {
+		return prefetchNotCached
+	}
+	if fc.IsCached(uri) {
+		return prefetchCached
+	}
+	if pp.upstreams[repo].offline {
+		return prefetchOffline
+	}
+	dl, leader := pp.downloads.acquire(uri)
+	if !leader {
+		return prefetchInProgress
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, uri, nil)
+	if err != nil {
+		pp.downloads.release(uri, dl, false)
+		return prefetchNotCached
+	}
+	slog.Info("cache prefetch", "request_id", rid, "uri", uri)
+	go pp.fetchDownload(req, rid, repo, uri, dl)
+	return prefetchStarted
+}
+
+func (pp *pkgProxy) adminListSnapshots(c *echo.Context) error {
+	repo := c.Param("repo")
+	if _, ok := pp.upstreams[repo]; !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{jsonKeyMessage: "Unknown repository"})
+	}
+	if pp.snapshots == nil {
+		return c.JSON(http.StatusOK, []cache.Snapshot{})
+	}
+	snapshots, err := pp.snapshots.List(repo)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{jsonKeyMessage: err.Error()})
+	}
+	return c.JSON(http.StatusOK, snapshots)
+}
+
+// adminCreateSnapshot freezes the currently cached metadata of a repository
+// in a new snapshot.
+func (pp *pkgProxy) adminCreateSnapshot(c *echo.Context) error {
+	repo := c.Param("repo")
+	upstream, ok := pp.upstreams[repo]
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{jsonKeyMessage: "Unknown repository"})
+	}
+	if pp.snapshots == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{jsonKeyMessage: "Snapshots are disabled"})
+	}
+	var body adminSnapshotRequest
+	if err := c.Bind(&body); err != nil || !cache.ValidSnapshotName(body.Name) {
+		return c.JSON(http.StatusBadRequest, map[string]string{jsonKeyMessage: "Expected JSON object with valid snapshot name"})
+	}
+
+	snapshot, err := pp.snapshots.Create(upstream.cache, repo, body.Name)
+	switch {
+	case errors.Is(err, cache.ErrSnapshotExists):
+		return c.JSON(http.StatusConflict, map[string]string{jsonKeyMessage: err.Error()})
+	case errors.Is(err, cache.ErrSnapshotEmpty):
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{jsonKeyMessage: err.Error()})
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, map[string]string{jsonKeyMessage: err.Error()})
+	}
+	slog.Info("snapshot create", "request_id", requestID(c), "repository", repo, "snapshot", body.Name, "files", snapshot.Files)
+	return c.JSON(http.StatusCreated, snapshot)
+}
+
+func (pp *pkgProxy) adminDeleteSnapshot(c *echo.Context) error {
+	repo := c.Param("repo")
+	if _, ok := pp.upstreams[repo]; !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{jsonKeyMessage: "Unknown repository"})
+	}
+	name := c.Param("name")
+	if !cache.ValidSnapshotName(name) {
+		return c.JSON(http.StatusBadRequest, map[string]string{jsonKeyMessage: "Invalid snapshot name"})
+	}
+	if pp.snapshots == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{jsonKeyMessage: "Unknown snapshot"})
+	}
+	err := pp.snapshots.Delete(repo, name)
+	if errors.Is(err, cache.ErrSnapshotNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{jsonKeyMessage: "Unknown snapshot"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{jsonKeyMessage: err.Error()})
+	}
+	slog.Info("snapshot delete", "request_id", requestID(c), "repository", repo, "snapshot", name, "remote_ip", c.RealIP(), "authorized_by", deleteByToken)
+	return c.JSON(http.StatusOK, map[string]string{jsonKeyMessage: "Success"})
+}
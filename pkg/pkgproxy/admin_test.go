@@ -0,0 +1,284 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package pkgproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	echo "github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAdminToken = "s3cret"
+
+// newTestAdminApp returns the test app with the admin API enabled.
+func newTestAdminApp(pp PkgProxy) *echo.Echo {
+	app := newTestApp(pp)
+	pp.Admin(app.Group(AdminPrefix, AdminAuth(testAdminToken)))
+	return app
+}
+
+// writeCachedFile creates a file in the cache directory for the given URI.
+func writeCachedFile(t *testing.T, cacheDir string, uri string, content string) {
+	t.Helper()
+	p := filepath.Join(cacheDir, filepath.FromSlash(uri))
+	require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o750))
+	require.NoError(t, os.WriteFile(p, []byte(content), 0o600))
+}
+
+func adminRequest(app *echo.Echo, method string, target string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminUnauthorized(t *testing.T) {
+	pp, _ := newTestProxy(t, []string{"http://localhost:1/"})
+	app := newTestAdminApp(pp)
+
+	for _, auth := range []string{"", "Bearer wrong", "Basic " + testAdminToken} {
+		req := httptest.NewRequest(http.MethodGet, AdminPrefix+"/repositories", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, auth)
+		assert.NotEmpty(t, rec.Header().Get("WWW-Authenticate"))
+	}
+}
+
+func TestAdminListRepositoriesAndFiles(t *testing.T) {
+	pp, cacheDir := newTestProxy(t, []string{"http://localhost:1/"})
+	writeCachedFile(t, cacheDir, "/testrepo/a/one.rpm", "111")
+	writeCachedFile(t, cacheDir, "/testrepo/b/two.rpm", "22")
+	writeCachedFile(t, cacheDir, "/testrepo/b/123.tmp", "ignored")
+	app := newTestAdminApp(pp)
+
+	rec := adminRequest(app, http.MethodGet, AdminPrefix+"/repositories", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var repos []adminRepository
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &repos))
+	require.Len(t, repos, 1)
+	assert.Equal(t, "testrepo", repos[0].Name)
+	assert.Equal(t, 2, repos[0].Files)
+	assert.Equal(t, int64(5), repos[0].Size)
+
+	rec = adminRequest(app, http.MethodGet, AdminPrefix+"/repositories/testrepo/files?prefix=b/", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var files []map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &files))
+	require.Len(t, files, 1)
+	assert.Equal(t, "/testrepo/b/two.rpm", files[0]["uri"])
+	assert.InDelta(t, 2, files[0]["size"], 0)
+	assert.NotEmpty(t, files[0]["mtime"])
+
+	rec = adminRequest(app, http.MethodGet, AdminPrefix+"/repositories/unknown/files", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestAdminPurge(t *testing.T) {
+	pp, cacheDir := newTestProxy(t, []string{"http://localhost:1/"})
+	writeCachedFile(t, cacheDir, "/testrepo/a/one.rpm", "111")
+	writeCachedFile(t, cacheDir, "/testrepo/a/one.drpm", "111")
+	writeCachedFile(t, cacheDir, "/testrepo/b/two.rpm", "22")
+	app := newTestAdminApp(pp)
+
+	rec := adminRequest(app, http.MethodDelete, AdminPrefix+"/repositories/testrepo/files", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "purge without filter must be rejected")
+
+	rec = adminRequest(app, http.MethodDelete, AdminPrefix+"/repositories/testrepo/files?glob=*.rpm", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var result adminPurgeResult
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	assert.Equal(t, adminPurgeResult{Deleted: 2, Size: 5}, result)
+	assert.NoFileExists(t, filepath.Join(cacheDir, "testrepo", "a", "one.rpm"))
+	assert.NoFileExists(t, filepath.Join(cacheDir, "testrepo", "b", "two.rpm"))
+	assert.FileExists(t, filepath.Join(cacheDir, "testrepo", "a", "one.drpm"))
+
+	rec = adminRequest(app, http.MethodDelete, AdminPrefix+"/repositories/testrepo/files?prefix=a/", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NoFileExists(t, filepath.Join(cacheDir, "testrepo", "a", "one.drpm"))
+}
+
+func TestAdminPrefixTraversal(t *testing.T) {
+	pp, cacheDir := newTestProxyWithRepo(t, Repository{Mirrors: []string{"http://localhost:1/"}})
+	writeCachedFile(t, cacheDir, "/testrepo/a/one.rpm", "111")
+	writeCachedFile(t, cacheDir, "/other/b/two.rpm", "22")
+	app := newTestAdminApp(pp)
+
+	for _, prefix := range []string{"..", "../other", "a/../../other", "../testrepo2"} {
+		query := "?prefix=" + url.QueryEscape(prefix)
+		rec := adminRequest(app, http.MethodGet, AdminPrefix+"/repositories/testrepo/files"+query, "")
+		assert.Equal(t, http.StatusBadRequest, rec.Code, prefix)
+		rec = adminRequest(app, http.MethodDelete, AdminPrefix+"/repositories/testrepo/files"+query, "")
+		assert.Equal(t, http.StatusBadRequest, rec.Code, prefix)
+	}
+	assert.FileExists(t, filepath.Join(cacheDir, "other", "b", "two.rpm"))
+
+	rec := adminRequest(app, http.MethodDelete, AdminPrefix+"/repositories/testrepo/files?prefix="+url.QueryEscape("b/../a"), "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NoFileExists(t, filepath.Join(cacheDir, "testrepo", "a", "one.rpm"))
+}
+
+func TestAdminPrefetchTraversal(t *testing.T) {
+	var requests atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fmt.Fprint(w, "prefetched")
+	}))
+	defer upstream.Close()
+
+	pp, cacheDir := newTestProxy(t, []string{upstream.URL + "/"})
+	app := newTestAdminApp(pp)
+
+	for _, p := range []string{"../other/x.rpm", "a/../../other/x.rpm", "../testrepo2/x.rpm", ".."} {
+		body := `{"paths": ["new.rpm", "` + p + `"]}`
+		rec := adminRequest(app, http.MethodPost, AdminPrefix+"/repositories/testrepo/prefetch", body)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, p)
+	}
+	assert.Equal(t, int32(0), requests.Load())
+	assert.NoDirExists(t, filepath.Join(cacheDir, "other"))
+	assert.NoFileExists(t, filepath.Join(cacheDir, "testrepo", "new.rpm"))
+}
+
+func TestAdminUsage(t *testing.T) {
+	pp, cacheDir := newTestProxy(t, []string{"http://localhost:1/"})
+	writeCachedFile(t, cacheDir, "/testrepo/a/one.rpm", "111")
+	writeCachedFile(t, cacheDir, "/other/a/one.rpm", "not a configured repository")
+	app := newTestAdminApp(pp)
+
+	rec := adminRequest(app, http.MethodGet, AdminPrefix+"/usage", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var usage adminUsage
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &usage))
+	assert.Equal(t, int64(3), usage.Total)
+	assert.Equal(t, map[string]int64{"testrepo": 3}, usage.Repositories)
+}
+
+func TestAdminPrefetch(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "prefetched")
+	}))
+	defer upstream.Close()
+
+	pp, cacheDir := newTestProxy(t, []string{upstream.URL + "/"})
+	writeCachedFile(t, cacheDir, "/testrepo/cached.rpm", "cached")
+	app := newTestAdminApp(pp)
+
+	rec := adminRequest(app, http.MethodPost, AdminPrefix+"/repositories/testrepo/prefetch",
+		`{"paths": ["path/new.rpm", "cached.rpm", "repodata/repomd.xml"]}`)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	var results []adminPrefetchResult
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &results))
+	assert.Equal(t, []adminPrefetchResult{
+		{Path: "path/new.rpm", Status: prefetchStarted},
+		{Path: "cached.rpm", Status: prefetchCached},
+		{Path: "repodata/repomd.xml", Status: prefetchNotCached},
+	}, results)
+
+	assert.Eventually(t, func() bool {
+		content, err := os.ReadFile(filepath.Join(cacheDir, "testrepo", "path", "new.rpm"))
+		return err == nil && string(content) == "prefetched"
+	}, time.Second, 10*time.Millisecond)
+
+	rec = adminRequest(app, http.MethodPost, AdminPrefix+"/repositories/testrepo/prefetch", `{}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestAdminPrefetchTimeout(t *testing.T) {
+	stalled := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "partial")
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-stalled:
+		}
+	}))
+	defer upstream.Close()
+	defer close(stalled)
+
+	timeout := downloadTimeout
+	downloadTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { downloadTimeout = timeout })
+
+	pp, cacheDir := newTestProxy(t, []string{upstream.URL + "/"})
+	app := newTestAdminApp(pp)
+	target := AdminPrefix + "/repositories/testrepo/prefetch"
+
+	rec := adminRequest(app, http.MethodPost, target, `{"paths": ["stalled.rpm"]}`)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Contains(t, rec.Body.String(), prefetchStarted)
+
+	rec = adminRequest(app, http.MethodPost, target, `{"paths": ["stalled.rpm"]}`)
+	assert.Contains(t, rec.Body.String(), prefetchInProgress)
+
+	// the download is released once the timeout expired
+	downloads := pp.(*pkgProxy).downloads
+	assert.Eventually(t, func() bool {
+		downloads.mu.Lock()
+		defer downloads.mu.Unlock()
+		return len(downloads.m) == 0
+	}, 2*time.Second, 20*time.Millisecond)
+	assert.NoFileExists(t, filepath.Join(cacheDir, "testrepo", "stalled.rpm"))
+}
+
+func TestAdminMirrors(t *testing.T) {
+	pp, _ := newTestProxy(t, []string{"http://mirror1.example.com/", "http://mirror2.example.com/"})
+	up := pp.(*pkgProxy).upstreams["testrepo"]
+	up.health.get(up.mirrors[1]).record(nil, fmt.Errorf("connection refused"), false)
+	app := newTestAdminApp(pp)
+
+	rec := adminRequest(app, http.MethodGet, AdminPrefix+"/mirrors", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var mirrors map[string][]mirrorStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &mirrors))
+	require.Len(t, mirrors["testrepo"], 2)
+	assert.Equal(t, "http://mirror1.example.com/", mirrors["testrepo"][0].URL)
+	assert.Equal(t, circuitClosed, mirrors["testrepo"][0].State)
+	assert.Equal(t, 1, mirrors["testrepo"][1].ConsecutiveFailures)
+	assert.Equal(t, "connection refused", mirrors["testrepo"][1].LastError)
+}
+
+func TestAdminPrefetchOffline(t *testing.T) {
+	cacheDir := t.TempDir()
+	pp := New(&PkgProxyConfig{
+		CacheBasePath: cacheDir,
+		RepositoryConfig: &RepoConfig{
+			Repositories: map[string]Repository{
+				"testrepo": {
+					CacheSuffixes: []string{".rpm"},
+					Mirrors:       []string{"http://localhost:1/"},
+				},
+			},
+		},
+		Offline: true,
+	})
+	app := newTestAdminApp(pp)
+
+	rec := adminRequest(app, http.MethodPost, AdminPrefix+"/repositories/testrepo/prefetch", `{"paths":["missing.rpm"]}`)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	var results []adminPrefetchResult
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &results))
+	assert.Equal(t, []adminPrefetchResult{{Path: "missing.rpm", Status: prefetchOffline}}, results)
+}
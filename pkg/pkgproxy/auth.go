@@ -0,0 +1,133 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package pkgproxy
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// upstreamAuth holds the resolved credentials of a repository. They are only
+// sent to the hosts of the configured mirrors, never to redirect targets on
+// other hosts, discovered mirrors or the parent pkgproxy.
+type upstreamAuth struct {
+	hosts  map[string]bool
+	header http.Header
+
+	// transport presenting the TLS client certificate, nil if none is
+	// configured
+	transport http.RoundTripper
+}
+
+// newUpstreamAuth resolves the credentials of config for the given mirrors.
+// The TLS client certificate is added to a clone of transport.
+func newUpstreamAuth(config *AuthConfig, mirrors []*url.URL, transport http.RoundTripper) (*upstreamAuth, error) {
+	header, err := config.header()
+	if err != nil {
+		return nil, err
+	}
+	auth := &upstreamAuth{hosts: map[string]bool{}, header: header}
+	for _, mirror := range mirrors {
+		auth.hosts[canonicalHost(mirror)] = true
+	}
+	if config.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(config.TLSCert, config.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load TLS client certificate: %w", err)
+		}
+		base, ok := transport.(*http.Transport)
+		if !ok {
+			return nil, errors.New("unable to use TLS client certificate with a custom transport")
+		}
+		t := base.Clone()
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		t.TLSClientConfig.Certificates = []tls.Certificate{cert}
+		auth.transport = t
+	}
+	return auth, nil
+}
+
+// matches reports whether the credentials may be sent to origin.
+func (a *upstreamAuth) matches(origin *url.URL) bool {
+	return a != nil && a.hosts[canonicalHost(origin)]
+}
+
+// apply sets the credential headers, replacing those sent by the client.
+func (a *upstreamAuth) apply(header http.Header) {
+	for name, value := range a.header {
+		header[name] = value
+	}
+}
+
+// canonicalHost returns the host of u including the default port of its
+// scheme, so that "example.com" and "example.com:443" are the same host.
+func canonicalHost(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(strings.ToLower(u.Hostname()), port)
+}
+
+// header returns the request headers carrying the configured credentials.
+func (a *AuthConfig) header() (http.Header, error) {
+	header := http.Header{}
+	for name, secret := range a.Headers {
+		value, err := secret.value()
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %w", name, err)
+		}
+		header.Set(name, value)
+	}
+	if a.Password != nil {
+		password, err := a.Password.value()
+		if err != nil {
+			return nil, fmt.Errorf("password: %w", err)
+		}
+		req := &http.Request{Header: http.Header{}}
+		req.SetBasicAuth(a.Username, password)
+		header.Set("Authorization", req.Header.Get("Authorization"))
+	}
+	if a.Token != nil {
+		token, err := a.Token.value()
+		if err != nil {
+			return nil, fmt.Errorf("token: %w", err)
+		}
+		header.Set("Authorization", "Bearer "+token)
+	}
+	return header, nil
+}
+
+// value returns the secret read from the file or environment variable.
+// Trailing newlines of files are removed.
+func (s *Secret) value() (string, error) {
+	switch {
+	case s.File != "" && s.Env != "":
+		return "", errors.New("file and env are mutually exclusive")
+	case s.File != "":
+		data, err := os.ReadFile(s.File)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case s.Env != "":
+		value, ok := os.LookupEnv(s.Env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", s.Env)
+		}
+		return value, nil
+	default:
+		return "", errors.New("missing file or env")
+	}
+}
@@ -11,9 +11,12 @@ type bufferWriter struct {
 	io.Writer
 	http.ResponseWriter
 	safe *safeWriter
+	// optional in-progress download to notify about the response status
+	download *download
 }
 
 func (w *bufferWriter) WriteHeader(code int) {
+	w.download.setHeader(code, w.ResponseWriter.Header())
 	if w.safe != nil && w.safe.failed {
 		return
 	}
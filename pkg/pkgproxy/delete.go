@@ -0,0 +1,84 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package pkgproxy
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	echo "github.com/labstack/echo/v5"
+)
+
+// Principals recorded in the audit log of DELETE requests
+const (
+	deleteByToken   = "admin-token"
+	deleteByNetwork = "trusted-network"
+	deleteByAnyone  = "unrestricted"
+)
+
+// deleteAuth decides which clients may remove cached files with DELETE
+// requests. Without token and trusted networks all clients passing the
+// access control of the repository may delete.
+type deleteAuth struct {
+	disabled bool
+	token    string
+	trusted  []*net.IPNet
+}
+
+// unrestricted reports whether DELETE requests need no authorization.
+func (d *deleteAuth) unrestricted() bool {
+	return d.token == "" && len(d.trusted) == 0
+}
+
+// hasToken reports whether the Authorization header value carries the admin
+// token as bearer token.
+func (d *deleteAuth) hasToken(authorization string) bool {
+	given, ok := strings.CutPrefix(authorization, "Bearer ")
+	return ok && d.token != "" && subtle.ConstantTimeCompare([]byte(given), []byte(d.token)) == 1
+}
+
+// authorize returns the principal authorizing the DELETE request with the
+// given Authorization header value, or "" if it isn't authorized.
+func (d *deleteAuth) authorize(c *echo.Context, authorization string) string {
+	if d.unrestricted() {
+		return deleteByAnyone
+	}
+	if d.hasToken(authorization) {
+		return deleteByToken
+	}
+	if ip := net.ParseIP(c.RealIP()); ip != nil {
+		for _, ipNet := range d.trusted {
+			if ipNet.Contains(ip) {
+				return deleteByNetwork
+			}
+		}
+	}
+	return ""
+}
+
+// authorizeDelete checks DELETE requests for repository files with the
+// Authorization header value sent by the client. It returns the authorizing
+// principal, or true if the request was rejected and the error response has
+// been written. Other requests pass with an empty principal.
+func (pp *pkgProxy) authorizeDelete(c *echo.Context, authorization string) (string, bool, error) {
+	req := c.Request()
+	if req.Method != httpMethodDelete || !pp.isRepositoryRequest(req.RequestURI) {
+		return "", false, nil
+	}
+	if pp.deleteAuth.disabled {
+		return "", true, c.JSON(http.StatusMethodNotAllowed, map[string]string{jsonKeyMessage: "Cache does not allow method DELETE"})
+	}
+	principal := pp.deleteAuth.authorize(c, authorization)
+	if principal == "" {
+		slog.Warn("cache delete rejected", "request_id", requestID(c), "uri", req.RequestURI, "remote_ip", c.RealIP())
+		if pp.deleteAuth.token != "" {
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="pkgproxy"`)
+			return "", true, c.JSON(http.StatusUnauthorized, map[string]string{jsonKeyMessage: "Unauthorized"})
+		}
+		return "", true, c.JSON(http.StatusForbidden, map[string]string{jsonKeyMessage: "Forbidden"})
+	}
+	return principal, false, nil
+}
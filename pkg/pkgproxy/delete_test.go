@@ -0,0 +1,154 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package pkgproxy
+
+import (
+	"bytes"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestProxyWithDelete creates a pkgProxy whose "testrepo" repository
+// allows clients from 192.0.2.0/24 and the given DELETE authorization.
+func newTestProxyWithDelete(t *testing.T, token string, trusted []string, disabled bool) (PkgProxy, string) {
+	t.Helper()
+	var trustedNets []*net.IPNet
+	for _, value := range trusted {
+		ipNet, err := ParseNetwork(value)
+		require.NoError(t, err)
+		trustedNets = append(trustedNets, ipNet)
+	}
+	return newTestProxyWithRepo(t, Repository{
+		Access:  &AccessConfig{Allow: []string{"192.0.2.0/24"}},
+		Mirrors: []string{"http://localhost:1/"},
+	}, func(config *PkgProxyConfig) {
+		config.AdminToken = token
+		config.DeleteTrusted = trustedNets
+		config.DisableDelete = disabled
+	})
+}
+
+func deleteRequest(pp PkgProxy, remoteAddr string, auth string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodDelete, "/testrepo/Packages/a.rpm", nil)
+	req.RemoteAddr = remoteAddr
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	rec := httptest.NewRecorder()
+	newTestApp(pp).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCacheDeleteRequiresAuthorization(t *testing.T) {
+	pp, cacheDir := newTestProxyWithDelete(t, testAdminToken, nil, false)
+	writeCachedFile(t, cacheDir, "/testrepo/Packages/a.rpm", "package")
+
+	for _, auth := range []string{"", "Bearer wrong", "Basic " + testAdminToken} {
+		rec := deleteRequest(pp, "192.0.2.1:1234", auth)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, auth)
+		assert.Equal(t, `Bearer realm="pkgproxy"`, rec.Header().Get("WWW-Authenticate"))
+	}
+	assert.FileExists(t, filepath.Join(cacheDir, "testrepo", "Packages", "a.rpm"))
+
+	// the admin token is still subject to the client access control
+	rec := deleteRequest(pp, "198.51.100.1:1234", "Bearer "+testAdminToken)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.FileExists(t, filepath.Join(cacheDir, "testrepo", "Packages", "a.rpm"))
+
+	rec = deleteRequest(pp, "192.0.2.1:1234", "Bearer "+testAdminToken)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoFileExists(t, filepath.Join(cacheDir, "testrepo", "Packages", "a.rpm"))
+}
+
+func TestCacheDeleteTokenWithClientCredentials(t *testing.T) {
+	t.Setenv("TEST_CLIENT_TOKEN", "client-token")
+	pp, cacheDir := newTestProxyWithRepo(t, Repository{
+		Access: &AccessConfig{
+			Allow:  []string{"192.0.2.0/24"},
+			Tokens: []Secret{{Env: "TEST_CLIENT_TOKEN"}},
+		},
+		Mirrors: []string{"http://localhost:1/"},
+	})
+	writeCachedFile(t, cacheDir, "/testrepo/Packages/a.rpm", "package")
+
+	// client credentials don't authorize DELETE
+	assert.Equal(t, http.StatusUnauthorized, deleteRequest(pp, "192.0.2.1:1234", "Bearer client-token").Code)
+	assert.FileExists(t, filepath.Join(cacheDir, "testrepo", "Packages", "a.rpm"))
+
+	// the admin token replaces the client credentials, not the networks
+	assert.Equal(t, http.StatusForbidden, deleteRequest(pp, "198.51.100.1:1234", "Bearer "+testAdminToken).Code)
+	assert.Equal(t, http.StatusOK, deleteRequest(pp, "192.0.2.1:1234", "Bearer "+testAdminToken).Code)
+	assert.NoFileExists(t, filepath.Join(cacheDir, "testrepo", "Packages", "a.rpm"))
+}
+
+func TestCacheDeleteUnrestricted(t *testing.T) {
+	pp, cacheDir := newTestProxyWithDelete(t, "", nil, false)
+	writeCachedFile(t, cacheDir, "/testrepo/Packages/a.rpm", "package")
+
+	assert.Equal(t, http.StatusForbidden, deleteRequest(pp, "198.51.100.1:1234", "").Code)
+	assert.FileExists(t, filepath.Join(cacheDir, "testrepo", "Packages", "a.rpm"))
+
+	assert.Equal(t, http.StatusOK, deleteRequest(pp, "192.0.2.1:1234", "").Code)
+	assert.NoFileExists(t, filepath.Join(cacheDir, "testrepo", "Packages", "a.rpm"))
+}
+
+func TestCacheDeleteTrustedNetwork(t *testing.T) {
+	pp, cacheDir := newTestProxyWithDelete(t, "", []string{"192.0.2.10", "198.51.100.0/24"}, false)
+	writeCachedFile(t, cacheDir, "/testrepo/Packages/a.rpm", "package")
+
+	rec := deleteRequest(pp, "192.0.2.11:1234", "Bearer "+testAdminToken)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.JSONEq(t, `{"message":"Forbidden"}`, rec.Body.String())
+	assert.FileExists(t, filepath.Join(cacheDir, "testrepo", "Packages", "a.rpm"))
+
+	// trusted networks are still subject to the client access control
+	assert.Equal(t, http.StatusForbidden, deleteRequest(pp, "198.51.100.1:1234", "").Code)
+	assert.FileExists(t, filepath.Join(cacheDir, "testrepo", "Packages", "a.rpm"))
+
+	assert.Equal(t, http.StatusOK, deleteRequest(pp, "192.0.2.10:1234", "").Code)
+	assert.NoFileExists(t, filepath.Join(cacheDir, "testrepo", "Packages", "a.rpm"))
+}
+
+func TestCacheDeleteDisabled(t *testing.T) {
+	pp, cacheDir := newTestProxyWithDelete(t, testAdminToken, []string{"192.0.2.0/24"}, true)
+	writeCachedFile(t, cacheDir, "/testrepo/Packages/a.rpm", "package")
+
+	rec := deleteRequest(pp, "192.0.2.1:1234", "Bearer "+testAdminToken)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.FileExists(t, filepath.Join(cacheDir, "testrepo", "Packages", "a.rpm"))
+
+	// other methods are not affected
+	req := httptest.NewRequest(http.MethodGet, "/testrepo/Packages/a.rpm", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	rec = httptest.NewRecorder()
+	newTestApp(pp).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestCacheDeleteAuditLog(t *testing.T) {
+	prev := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	var buf bytes.Buffer
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+
+	pp, cacheDir := newTestProxyWithDelete(t, testAdminToken, []string{"192.0.2.10"}, false)
+	writeCachedFile(t, cacheDir, "/testrepo/Packages/a.rpm", "package")
+
+	deleteRequest(pp, "192.0.2.1:1234", "")
+	assert.Contains(t, buf.String(), `msg="cache delete rejected"`)
+	assert.Contains(t, buf.String(), "remote_ip=192.0.2.1")
+
+	buf.Reset()
+	require.Equal(t, http.StatusOK, deleteRequest(pp, "192.0.2.10:1234", "").Code)
+	assert.Contains(t, buf.String(), `msg="cache delete"`)
+	assert.Contains(t, buf.String(), "uri=/testrepo/Packages/a.rpm")
+	assert.Contains(t, buf.String(), "remote_ip=192.0.2.10")
+	assert.Contains(t, buf.String(), "authorized_by=trusted-network")
+}
@@ -0,0 +1,267 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package pkgproxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/ganto/pkgproxy/pkg/cache"
+)
+
+// downloads keeps track of the cache misses that are currently fetched from
+// upstream, so that concurrent requests for the same URI are coalesced into a
+// single upstream request.
+type downloads struct {
+	mu sync.Mutex
+	m  map[string]*download
+}
+
+// download represents a single in-progress upstream fetch that is written to a
+// temp file in the cache. Followers read the growing temp file while the
+// leader is still writing to it.
+type download struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	// upstream response status and headers, status is 0 until known
+	status int
+	header http.Header
+
+	// temp file and number of bytes written to it so far
+	tmpPath string
+	size    int64
+
+	// done is set once the leader finished, complete if the full response
+	// body was written to the temp file
+	done     bool
+	complete bool
+}
+
+func newDownloads() *downloads {
+	return &downloads{m: map[string]*download{}}
+}
+
+// acquire returns the in-progress download for uri. If there is none, a new
+// download is registered and the caller becomes its leader.
+func (d *downloads) acquire(uri string) (dl *download, leader bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if dl, ok := d.m[uri]; ok {
+		return dl, false
+	}
+	dl = &download{}
+	dl.cond = sync.NewCond(&dl.mu)
+	d.m[uri] = dl
+	return dl, true
+}
+
+// release marks the download as finished and unregisters it, so that
+// subsequent requests for uri either hit the cache or start a new download.
+func (d *downloads) release(uri string, dl *download, complete bool) {
+	if dl == nil {
+		return
+	}
+	d.mu.Lock()
+	if d.m[uri] == dl {
+		delete(d.m, uri)
+	}
+	d.mu.Unlock()
+	dl.finish(complete)
+}
+
+// setHeader records the upstream response status and headers.
+func (dl *download) setHeader(status int, header http.Header) {
+	if dl == nil {
+		return
+	}
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	if dl.done || dl.status != 0 {
+		return
+	}
+	dl.status = status
+	dl.header = header.Clone()
+	dl.cond.Broadcast()
+}
+
+// setProgress records the temp file and the number of bytes written to it.
+func (dl *download) setProgress(tmpPath string, size int64) {
+	if dl == nil {
+		return
+	}
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	dl.tmpPath = tmpPath
+	dl.size = size
+	dl.cond.Broadcast()
+}
+
+// finish wakes up all followers once the leader is done.
+func (dl *download) finish(complete bool) {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	dl.done = true
+	dl.complete = complete
+	dl.cond.Broadcast()
+}
+
+// wait blocks until cond returns true or ctx is canceled. The caller must
+// hold dl.mu.
+func (dl *download) wait(ctx context.Context, cond func() bool) error {
+	stop := context.AfterFunc(ctx, func() {
+		dl.mu.Lock()
+		defer dl.mu.Unlock()
+		dl.cond.Broadcast()
+	})
+	defer stop()
+	for !cond() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		dl.cond.Wait()
+	}
+	return nil
+}
+
+// waitHeader blocks until the upstream response status is known or the
+// leader finished without receiving a response.
+func (dl *download) waitHeader(ctx context.Context) (int, http.Header, error) {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	err := dl.wait(ctx, func() bool { return dl.status != 0 || dl.done })
+	return dl.status, dl.header, err
+}
+
+// open blocks until the temp file exists and opens it for reading. It returns
+// a nil file if the download finished before the temp file could be opened,
+// e.g. because it was already committed to the cache.
+func (dl *download) open(ctx context.Context) (*os.File, error) {
+	dl.mu.Lock()
+	err := dl.wait(ctx, func() bool { return dl.tmpPath != "" || dl.done })
+	tmpPath := dl.tmpPath
+	dl.mu.Unlock()
+	if err != nil || tmpPath == "" {
+		return nil, err
+	}
+	f, err := os.Open(tmpPath) //nolint:gosec // path was created by CreateTempWriter
+	if errors.Is(err, os.ErrNotExist) {
+		// the temp file was committed or removed, wait for the outcome
+		dl.mu.Lock()
+		defer dl.mu.Unlock()
+		return nil, dl.wait(ctx, func() bool { return dl.done })
+	}
+	return f, err
+}
+
+// isComplete reports whether the leader finished and wrote the full response
+// body.
+func (dl *download) isComplete() bool {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	return dl.done && dl.complete
+}
+
+// progressWriter writes to the temp file of a download and notifies it about
+// the number of bytes written so far.
+type progressWriter struct {
+	file     cache.TempFile
+	download *download
+	written  int64
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	n, err := w.file.Write(b)
+	w.written += int64(n)
+	w.download.setProgress(w.file.Name(), w.written)
+	return n, err
+}
+
+// downloadReader is an io.ReadSeeker on the temp file of an in-progress
+// download. Reads block until the requested data was written by the leader.
+type downloadReader struct {
+	ctx    context.Context
+	dl     *download
+	file   *os.File
+	offset int64
+	// expected total size from the Content-Length header, -1 if unknown
+	length int64
+}
+
+func newDownloadReader(ctx context.Context, dl *download, f *os.File, header http.Header) *downloadReader {
+	length := int64(-1)
+	if cl, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil && cl >= 0 {
+		length = cl
+	}
+	return &downloadReader{ctx: ctx, dl: dl, file: f, length: length}
+}
+
+func (r *downloadReader) Read(b []byte) (int, error) {
+	r.dl.mu.Lock()
+	err := r.dl.wait(r.ctx, func() bool { return r.dl.size > r.offset || r.dl.done })
+	available := r.dl.size - r.offset
+	complete := r.dl.complete
+	r.dl.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	if available <= 0 {
+		if complete {
+			return 0, io.EOF
+		}
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	if int64(len(b)) > available {
+		b = b[:available]
+	}
+	n, err := r.file.ReadAt(b, r.offset)
+	r.offset += int64(n)
+	if errors.Is(err, io.EOF) && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *downloadReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		size, err := r.size()
+		if err != nil {
+			return 0, err
+		}
+		offset += size
+	default:
+		return 0, errors.New("downloadReader.Seek: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("downloadReader.Seek: negative position")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// size returns the expected size of the file. If the upstream server didn't
+// send a Content-Length, it blocks until the download is finished.
+func (r *downloadReader) size() (int64, error) {
+	if r.length >= 0 {
+		return r.length, nil
+	}
+	r.dl.mu.Lock()
+	defer r.dl.mu.Unlock()
+	if err := r.dl.wait(r.ctx, func() bool { return r.dl.done }); err != nil {
+		return 0, err
+	}
+	if !r.dl.complete {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return r.dl.size, nil
+}
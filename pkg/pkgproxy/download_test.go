@@ -0,0 +1,119 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package pkgproxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadsAcquire(t *testing.T) {
+	d := newDownloads()
+
+	dl, leader := d.acquire("/repo/file.rpm")
+	assert.True(t, leader)
+	other, leader := d.acquire("/repo/file.rpm")
+	assert.False(t, leader)
+	assert.Same(t, dl, other)
+
+	d.release("/repo/file.rpm", dl, true)
+	assert.True(t, dl.isComplete())
+	next, leader := d.acquire("/repo/file.rpm")
+	assert.True(t, leader)
+	assert.NotSame(t, dl, next)
+}
+
+func TestDownloadReaderFollowsWriter(t *testing.T) {
+	tmpPath := filepath.Join(t.TempDir(), "file.tmp")
+	w, err := os.Create(tmpPath)
+	require.NoError(t, err)
+	defer w.Close()
+
+	d := newDownloads()
+	dl, _ := d.acquire("/repo/file.rpm")
+	dl.setHeader(http.StatusOK, http.Header{"Content-Length": []string{"10"}})
+
+	go func() {
+		for i, chunk := range []string{"01234", "56789"} {
+			_, _ = w.WriteString(chunk)
+			dl.setProgress(tmpPath, int64((i+1)*len(chunk)))
+			time.Sleep(10 * time.Millisecond)
+		}
+		d.release("/repo/file.rpm", dl, true)
+	}()
+
+	f, err := dl.open(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, f)
+	defer f.Close()
+
+	_, header, err := dl.waitHeader(context.Background())
+	require.NoError(t, err)
+	r := newDownloadReader(context.Background(), dl, f, header)
+	size, err := r.Seek(0, io.SeekEnd)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), size)
+	_, err = r.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", string(data))
+}
+
+func TestDownloadReaderIncomplete(t *testing.T) {
+	tmpPath := filepath.Join(t.TempDir(), "file.tmp")
+	require.NoError(t, os.WriteFile(tmpPath, []byte("01234"), 0o600))
+
+	d := newDownloads()
+	dl, _ := d.acquire("/repo/file.rpm")
+	dl.setHeader(http.StatusOK, http.Header{})
+	dl.setProgress(tmpPath, 5)
+	d.release("/repo/file.rpm", dl, false)
+
+	f, err := dl.open(context.Background())
+	require.NoError(t, err)
+	defer f.Close()
+
+	r := newDownloadReader(context.Background(), dl, f, http.Header{})
+	data, err := io.ReadAll(r)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Equal(t, "01234", string(data))
+}
+
+func TestDownloadWaitCanceled(t *testing.T) {
+	d := newDownloads()
+	dl, _ := d.acquire("/repo/file.rpm")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, _, err := dl.waitHeader(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestStoreResponseHidesUnverifiedTempFile(t *testing.T) {
+	pp, _ := newTestProxy(t, []string{"http://localhost:1/"})
+	fc := pp.(*pkgProxy).upstreams["testrepo"].cache
+	sum := sha256.Sum256([]byte("package-body"))
+
+	for checksum, published := range map[string]bool{"": true, hex.EncodeToString(sum[:]): false} {
+		d := newDownloads()
+		dl, _ := d.acquire("/testrepo/Packages/file.rpm")
+		rsp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("package-body"))}
+		require.NoError(t, storeResponse(fc, "", "/testrepo/Packages/file.rpm", rsp, dl, checksum))
+		dl.mu.Lock()
+		assert.Equal(t, published, dl.tmpPath != "", checksum)
+		dl.mu.Unlock()
+	}
+}
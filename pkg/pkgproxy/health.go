@@ -0,0 +1,270 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package pkgproxy
+
+import (
+	"cmp"
+	"errors"
+	"iter"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states of a mirror
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half-open"
+)
+
+var (
+	// Default number of consecutive failures after which a mirror is skipped
+	defaultFailureThreshold = 3
+
+	// Default time a failed mirror is skipped before it is probed again
+	defaultCoolOff = 30 * time.Second
+
+	// Weight of a new sample in the latency moving average
+	latencyEWMAWeight = 0.3
+)
+
+// errAllCircuitsOpen is returned if no request was sent upstream, because the
+// circuits of all mirrors are open.
+var errAllCircuitsOpen = errors.New("all mirrors are unhealthy")
+
+// mirrorHealth tracks the health of a single mirror. Once a mirror failed
+// threshold times in a row, its circuit is opened and it is skipped for the
+// cool-off period. Afterwards, a single request is let through as probe
+// (half-open) which either closes the circuit again or reopens it.
+type mirrorHealth struct {
+	repo      string
+	mirror    string
+	threshold int
+	coolOff   time.Duration
+
+	mu        sync.Mutex
+	state     string
+	failures  int
+	lastError string
+	lastFail  time.Time
+	openUntil time.Time
+	latency   time.Duration // moving average, 0 until the first response
+}
+
+// mirrorStatus is the health of a mirror as reported by the admin API.
+type mirrorStatus struct {
+	URL                 string     `json:"url"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastFailure         *time.Time `json:"last_failure,omitempty"`
+	OpenUntil           *time.Time `json:"open_until,omitempty"`
+	LatencyMillis       float64    `json:"latency_ms"`
+}
+
+func newMirrorHealth(repo string, mirror string, threshold int, coolOff time.Duration) *mirrorHealth {
+	return &mirrorHealth{
+		repo:      repo,
+		mirror:    mirror,
+		threshold: threshold,
+		coolOff:   coolOff,
+		state:     circuitClosed,
+	}
+}
+
+// allow reports whether a request may be sent to the mirror. If the cool-off
+// period of an open circuit has expired, the caller is let through as the
+// single probe and the circuit becomes half-open.
+func (h *mirrorHealth) allow() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch h.state {
+	case circuitClosed:
+		return true
+	case circuitOpen:
+		if time.Now().Before(h.openUntil) {
+			return false
+		}
+		h.state = circuitHalfOpen
+		slog.Info("mirror circuit half-open, probing", "repository", h.repo, "mirror", h.mirror)
+		return true
+	default:
+		// a probe is already in flight
+		return false
+	}
+}
+
+// observeLatency adds the time until the response headers were received to
+// the latency moving average.
+func (h *mirrorHealth) observeLatency(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.latency == 0 {
+		h.latency = d
+		return
+	}
+	h.latency = time.Duration(latencyEWMAWeight*float64(d) + (1-latencyEWMAWeight)*float64(h.latency))
+}
+
+// record updates the health with the outcome of a request to the mirror.
+// Connection errors and 5xx responses count as failure, any other response
+// as success. If the request was canceled, a pending probe is given up
+// without changing the health.
+func (h *mirrorHealth) record(rsp *http.Response, err error, canceled bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if canceled {
+		if h.state == circuitHalfOpen {
+			h.state = circuitOpen
+		}
+		return
+	}
+
+	var failure string
+	switch {
+	case err != nil:
+		failure = err.Error()
+	case rsp != nil && rsp.StatusCode >= http.StatusInternalServerError:
+		failure = rsp.Status
+	}
+	if failure == "" {
+		if h.state != circuitClosed {
+			slog.Info("mirror circuit closed", "repository", h.repo, "mirror", h.mirror)
+		}
+		h.state = circuitClosed
+		h.failures = 0
+		return
+	}
+
+	h.failures++
+	h.lastError = failure
+	h.lastFail = time.Now()
+	if h.state == circuitHalfOpen || (h.state == circuitClosed && h.failures >= h.threshold) {
+		h.state = circuitOpen
+		h.openUntil = h.lastFail.Add(h.coolOff)
+		slog.Warn("mirror circuit opened", "repository", h.repo, "mirror", h.mirror,
+			"failures", h.failures, "error", failure, "cool_off", h.coolOff)
+	}
+}
+
+// status returns a snapshot of the mirror health.
+func (h *mirrorHealth) status(url string) mirrorStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := mirrorStatus{
+		URL:                 url,
+		State:               h.state,
+		ConsecutiveFailures: h.failures,
+		LastError:           h.lastError,
+		LatencyMillis:       float64(h.latency) / float64(time.Millisecond),
+	}
+	if !h.lastFail.IsZero() {
+		lastFail := h.lastFail
+		s.LastFailure = &lastFail
+	}
+	if h.state != circuitClosed {
+		openUntil := h.openUntil
+		s.OpenUntil = &openUntil
+	}
+	return s
+}
+
+// getLatency returns the latency moving average of the mirror.
+func (h *mirrorHealth) getLatency() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.latency
+}
+
+// mirrorHealthSet holds the health of the mirrors of a repository by URL, so
+// that it is kept when the mirror list is refreshed.
+type mirrorHealthSet struct {
+	repo      string
+	threshold int
+	coolOff   time.Duration
+
+	mu sync.Mutex
+	m  map[string]*mirrorHealth
+}
+
+func newMirrorHealthSet(repo string, threshold int, coolOff time.Duration) *mirrorHealthSet {
+	return &mirrorHealthSet{
+		repo:      repo,
+		threshold: threshold,
+		coolOff:   coolOff,
+		m:         map[string]*mirrorHealth{},
+	}
+}
+
+// get returns the health of the given mirror.
+func (s *mirrorHealthSet) get(mirror *url.URL) *mirrorHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := mirror.String()
+	h, ok := s.m[key]
+	if !ok {
+		h = newMirrorHealth(s.repo, mirror.Host, s.threshold, s.coolOff)
+		s.m[key] = h
+	}
+	return h
+}
+
+// mirrors yields the mirrors of repo that should be tried with their index in
+// the mirror list, in list order or, if enabled, ordered by latency. Mirrors
+// with an open circuit are skipped. If all circuits are open, nothing is
+// yielded and the request fails fast, until the cool-off of a mirror expired
+// and a single request is let through as probe.
+func (pp *pkgProxy) mirrors(rid string, repo string) iter.Seq2[int, *url.URL] {
+	return func(yield func(int, *url.URL) bool) {
+		up := pp.upstreams[repo]
+		mirrors := pp.mirrorList(repo)
+		health := make([]*mirrorHealth, len(mirrors))
+		order := make([]int, len(mirrors))
+		for i, mirror := range mirrors {
+			health[i] = up.health.get(mirror)
+			order[i] = i
+		}
+		if up.orderByLatency {
+			// mirrors without samples have a latency of 0 and are tried
+			// first, so that their latency becomes known
+			latency := make([]time.Duration, len(order))
+			for i, h := range health {
+				latency[i] = h.getLatency()
+			}
+			slices.SortStableFunc(order, func(a, b int) int {
+				return cmp.Compare(latency[a], latency[b])
+			})
+		}
+
+		// the parent pkgproxy is always tried before the mirrors. Its health
+		// is independent of the mirrors, which are still tried if it fails.
+		if up.parent != nil {
+			if up.health.get(up.parent).allow() {
+				if !yield(parentIndex, up.parent) {
+					return
+				}
+			} else {
+				slog.Debug("skipping unhealthy parent", "request_id", rid, "repository", repo)
+			}
+		}
+		tried := false
+		for _, i := range order {
+			if !health[i].allow() {
+				slog.Debug("skipping unhealthy mirror", "request_id", rid, "repository", repo, "mirror_index", i)
+				continue
+			}
+			tried = true
+			if !yield(i, mirrors[i]) {
+				return
+			}
+		}
+		if !tried && len(mirrors) > 0 {
+			slog.Warn("all mirrors unhealthy, failing fast", "request_id", rid, "repository", repo)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package pkgproxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirrorHealthOpensAfterThreshold(t *testing.T) {
+	h := newMirrorHealth("testrepo", "mirror", 2, time.Hour)
+
+	h.record(nil, errors.New("connection refused"), false)
+	assert.True(t, h.allow())
+	h.record(&http.Response{StatusCode: http.StatusBadGateway, Status: "502 Bad Gateway"}, nil, false)
+	assert.False(t, h.allow())
+
+	s := h.status("http://mirror/")
+	assert.Equal(t, circuitOpen, s.State)
+	assert.Equal(t, 2, s.ConsecutiveFailures)
+	assert.Equal(t, "502 Bad Gateway", s.LastError)
+	assert.NotNil(t, s.OpenUntil)
+}
+
+func TestMirrorHealthSuccessResetsFailures(t *testing.T) {
+	h := newMirrorHealth("testrepo", "mirror", 2, time.Hour)
+
+	h.record(nil, errors.New("connection refused"), false)
+	h.record(&http.Response{StatusCode: http.StatusNotFound}, nil, false)
+	h.record(nil, errors.New("connection refused"), false)
+	assert.True(t, h.allow())
+	assert.Equal(t, 1, h.status("").ConsecutiveFailures)
+}
+
+func TestMirrorHealthHalfOpenProbe(t *testing.T) {
+	h := newMirrorHealth("testrepo", "mirror", 1, 0)
+
+	h.record(nil, errors.New("timeout"), false)
+	assert.Equal(t, circuitOpen, h.status("").State)
+
+	// cool-off expired: only a single probe is let through
+	assert.True(t, h.allow())
+	assert.False(t, h.allow())
+	assert.Equal(t, circuitHalfOpen, h.status("").State)
+
+	// a failed probe reopens the circuit
+	h.record(nil, errors.New("timeout"), false)
+	assert.Equal(t, circuitOpen, h.status("").State)
+
+	// a successful probe closes it
+	assert.True(t, h.allow())
+	h.record(&http.Response{StatusCode: http.StatusOK}, nil, false)
+	assert.Equal(t, circuitClosed, h.status("").State)
+	assert.Equal(t, 0, h.status("").ConsecutiveFailures)
+}
+
+func TestMirrorHealthCanceledProbe(t *testing.T) {
+	h := newMirrorHealth("testrepo", "mirror", 1, 0)
+	h.record(nil, errors.New("timeout"), false)
+	require.True(t, h.allow())
+
+	h.record(nil, errors.New("context canceled"), true)
+	assert.Equal(t, circuitOpen, h.status("").State)
+	assert.Equal(t, 1, h.status("").ConsecutiveFailures)
+	assert.True(t, h.allow(), "a new probe is allowed after the canceled one")
+}
+
+func TestMirrorHealthLatencyEWMA(t *testing.T) {
+	h := newMirrorHealth("testrepo", "mirror", 1, 0)
+	h.observeLatency(100 * time.Millisecond)
+	assert.Equal(t, 100*time.Millisecond, h.getLatency())
+	h.observeLatency(200 * time.Millisecond)
+	assert.Equal(t, 130*time.Millisecond, h.getLatency())
+}
+
+func TestMirrorsOrder(t *testing.T) {
+	pp := New(&PkgProxyConfig{
+		CacheBasePath: t.TempDir(),
+		RepositoryConfig: &RepoConfig{
+			Repositories: map[string]Repository{
+				"config": {
+					CacheSuffixes: []string{".rpm"},
+					Mirrors:       []string{"http://a/", "http://b/", "http://c/"},
+				},
+				"latency": {
+					CacheSuffixes: []string{".rpm"},
+					Mirrors:       []string{"http://a/", "http://b/", "http://c/"},
+					MirrorHealth:  &MirrorHealthConfig{OrderByLatency: true},
+				},
+			},
+		},
+	}).(*pkgProxy)
+
+	health := func(repo string, i int) *mirrorHealth {
+		up := pp.upstreams[repo]
+		return up.health.get(up.mirrors[i])
+	}
+	order := func(repo string) []int {
+		var indexes []int
+		for i := range pp.mirrors("", repo) {
+			indexes = append(indexes, i)
+		}
+		return indexes
+	}
+
+	for _, repo := range []string{"config", "latency"} {
+		health(repo, 0).observeLatency(300 * time.Millisecond)
+		health(repo, 1).observeLatency(100 * time.Millisecond)
+		health(repo, 2).observeLatency(200 * time.Millisecond)
+	}
+	assert.Equal(t, []int{0, 1, 2}, order("config"))
+	assert.Equal(t, []int{1, 2, 0}, order("latency"))
+
+	// open circuits are skipped
+	for range defaultFailureThreshold {
+		health("config", 1).record(nil, errors.New("timeout"), false)
+	}
+	assert.Equal(t, []int{0, 2}, order("config"))
+
+	// if no mirror is healthy, none is tried
+	for _, i := range []int{0, 2} {
+		for range defaultFailureThreshold {
+			health("config", i).record(nil, errors.New("timeout"), false)
+		}
+	}
+	assert.Empty(t, order("config"))
+
+	// once the cool-off expired, a single request probes the mirror
+	health("config", 2).openUntil = time.Now()
+	assert.Equal(t, []int{2}, order("config"))
+	assert.Empty(t, order("config"))
+}
+
+func TestForwardProxyAllCircuitsOpen(t *testing.T) {
+	var hits atomic.Int32
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer mirror.Close()
+
+	pp, _ := newTestProxy(t, []string{mirror.URL + "/"})
+	app := newTestApp(pp)
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/testrepo/path/file.txt", nil))
+		return rec
+	}
+	for range defaultFailureThreshold {
+		assert.Equal(t, http.StatusServiceUnavailable, get().Code)
+	}
+	require.Equal(t, int32(defaultFailureThreshold), hits.Load())
+
+	// requests fail fast while the circuit is open
+	rec := get()
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Contains(t, rec.Body.String(), errAllCircuitsOpen.Error())
+	assert.Equal(t, int32(defaultFailureThreshold), hits.Load())
+}
+
+func TestForwardProxySkipsUnhealthyMirror(t *testing.T) {
+	var hits1 atomic.Int32
+	mirror1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits1.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer mirror1.Close()
+	mirror2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "mirror2-body")
+	}))
+	defer mirror2.Close()
+
+	pp, _ := newTestProxy(t, []string{mirror1.URL + "/", mirror2.URL + "/"})
+	app := newTestApp(pp)
+
+	for range defaultFailureThreshold + 2 {
+		req := httptest.NewRequest(http.MethodGet, "/testrepo/path/file.txt", nil)
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "mirror2-body", rec.Body.String())
+	}
+	assert.Equal(t, int32(defaultFailureThreshold), hits1.Load())
+}
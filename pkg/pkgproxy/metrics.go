@@ -0,0 +1,161 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package pkgproxy
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ganto/pkgproxy/pkg/cache"
+	echo "github.com/labstack/echo/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "pkgproxy"
+
+// Source labels of the served bytes
+const (
+	sourceCache    = "cache"
+	sourceUpstream = "upstream"
+)
+
+// metrics holds the Prometheus collectors of a pkgProxy. Each instance uses
+// its own registry so that multiple proxies can coexist (e.g. in tests).
+type metrics struct {
+	registry *prometheus.Registry
+
+	cacheHits           *prometheus.CounterVec
+	cacheMisses         *prometheus.CounterVec
+	cacheCommits        *prometheus.CounterVec
+	cacheCommitFailures *prometheus.CounterVec
+	negativeCacheHits   *prometheus.CounterVec
+	servedBytes         *prometheus.CounterVec
+	upstreamDuration    *prometheus.HistogramVec
+	upstreamResponses   *prometheus.CounterVec
+	upstreamRetries     *prometheus.CounterVec
+}
+
+func newMetrics(evictor *cache.Evictor, repos []string) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		cacheHits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "cache_hits_total",
+			Help:      "Number of requests served from the cache.",
+		}, []string{"repository"}),
+		cacheMisses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "cache_misses_total",
+			Help:      "Number of requests for cache candidates which were not cached.",
+		}, []string{"repository"}),
+		cacheCommits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "cache_commits_total",
+			Help:      "Number of files written to the cache.",
+		}, []string{"repository"}),
+		cacheCommitFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "cache_commit_failures_total",
+			Help:      "Number of downloaded files which could not be written to the cache.",
+		}, []string{"repository"}),
+		negativeCacheHits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "negative_cache_hits_total",
+			Help:      "Number of requests answered with 404 from the negative cache.",
+		}, []string{"repository"}),
+		servedBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "served_bytes_total",
+			Help:      "Number of response body bytes sent to clients by source (cache or upstream).",
+		}, []string{"repository", "source"}),
+		upstreamDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "upstream_request_duration_seconds",
+			Help:      "Time until the response headers of an upstream mirror were received.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"repository", "mirror"}),
+		upstreamResponses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "upstream_responses_total",
+			Help:      "Number of upstream responses by mirror and status code. Connection errors are counted with code \"error\".",
+		}, []string{"repository", "mirror", "code"}),
+		upstreamRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "upstream_retries_total",
+			Help:      "Number of retried upstream requests by mirror.",
+		}, []string{"repository", "mirror"}),
+	}
+
+	cacheSize := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "cache_size_bytes",
+		Help:      "Total size of all cached files.",
+	}, func() float64 {
+		return float64(evictor.TotalUsage())
+	})
+
+	m.registry.MustRegister(
+		m.cacheHits,
+		m.cacheMisses,
+		m.cacheCommits,
+		m.cacheCommitFailures,
+		m.negativeCacheHits,
+		m.servedBytes,
+		m.upstreamDuration,
+		m.upstreamResponses,
+		m.upstreamRetries,
+		cacheSize,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	for _, repo := range repos {
+		m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   metricsNamespace,
+			Name:        "repository_cache_size_bytes",
+			Help:        "Size of the cached files of a repository.",
+			ConstLabels: prometheus.Labels{"repository": repo},
+		}, func() float64 {
+			return float64(evictor.Usage(repo))
+		}))
+		// initialize the counters so that they are exported before the first request
+		m.cacheHits.WithLabelValues(repo)
+		m.cacheMisses.WithLabelValues(repo)
+		m.cacheCommits.WithLabelValues(repo)
+		m.cacheCommitFailures.WithLabelValues(repo)
+	}
+	return m
+}
+
+// MetricsHandler returns the HTTP handler exposing the Prometheus metrics.
+func (pp *pkgProxy) MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(pp.metrics.registry, promhttp.HandlerOpts{})
+}
+
+// observeUpstream records the response (or error) of an upstream mirror.
+func (m *metrics) observeUpstream(repo string, mirror string, start time.Time, rsp *http.Response, err error) {
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(rsp.StatusCode)
+		m.upstreamDuration.WithLabelValues(repo, mirror).Observe(time.Since(start).Seconds())
+	}
+	m.upstreamResponses.WithLabelValues(repo, mirror, code).Inc()
+}
+
+// countServed adds the number of bytes written to the client since the
+// response had the given size.
+func (m *metrics) countServed(c *echo.Context, repo string, source string, before int64) {
+	if resp, _ := echo.UnwrapResponse(c.Response()); resp != nil && resp.Size > before {
+		m.servedBytes.WithLabelValues(repo, source).Add(float64(resp.Size - before))
+	}
+}
+
+// responseSize returns the number of bytes written to the client so far.
+func responseSize(c *echo.Context) int64 {
+	if resp, _ := echo.UnwrapResponse(c.Response()); resp != nil {
+		return resp.Size
+	}
+	return 0
+}
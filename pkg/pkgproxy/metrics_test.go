@@ -0,0 +1,77 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package pkgproxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsCacheMissAndHit(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "upstream-body")
+	}))
+	defer upstream.Close()
+
+	pp, _ := newTestProxy(t, []string{upstream.URL + "/"})
+	app := newTestApp(pp)
+
+	for range 2 {
+		req := httptest.NewRequest(http.MethodGet, "/testrepo/path/file.rpm", nil)
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	m := pp.(*pkgProxy).metrics
+	mirror, err := url.Parse(upstream.URL)
+	require.NoError(t, err)
+	assert.InDelta(t, 1, testutil.ToFloat64(m.cacheMisses.WithLabelValues("testrepo")), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(m.cacheHits.WithLabelValues("testrepo")), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(m.cacheCommits.WithLabelValues("testrepo")), 0)
+	assert.InDelta(t, len("upstream-body"), testutil.ToFloat64(m.servedBytes.WithLabelValues("testrepo", sourceUpstream)), 0)
+	assert.InDelta(t, len("upstream-body"), testutil.ToFloat64(m.servedBytes.WithLabelValues("testrepo", sourceCache)), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(m.upstreamResponses.WithLabelValues("testrepo", mirror.Host, "200")), 0)
+}
+
+func TestMetricsUpstreamRetries(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	pp, _ := newTestProxyWithRetries(t, []string{upstream.URL + "/"}, 3)
+	app := newTestApp(pp)
+
+	req := httptest.NewRequest(http.MethodGet, "/testrepo/path/file.rpm", nil)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	m := pp.(*pkgProxy).metrics
+	mirror, err := url.Parse(upstream.URL)
+	require.NoError(t, err)
+	assert.InDelta(t, 2, testutil.ToFloat64(m.upstreamRetries.WithLabelValues("testrepo", mirror.Host)), 0)
+	assert.InDelta(t, 3, testutil.ToFloat64(m.upstreamResponses.WithLabelValues("testrepo", mirror.Host, "503")), 0)
+}
+
+func TestMetricsHandler(t *testing.T) {
+	pp, _ := newTestProxy(t, []string{"http://localhost:1/"})
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	pp.MetricsHandler().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `pkgproxy_cache_hits_total{repository="testrepo"} 0`)
+	assert.Contains(t, rec.Body.String(), "pkgproxy_cache_size_bytes")
+	assert.Contains(t, rec.Body.String(), `pkgproxy_repository_cache_size_bytes{repository="testrepo"}`)
+}
@@ -0,0 +1,208 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package pkgproxy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ganto/pkgproxy/pkg/repodata"
+)
+
+var (
+	// Default interval after which a metalink or mirror list is fetched again
+	defaultMirrorRefresh = 1 * time.Hour
+
+	// Interval after which a failed metalink or mirror list fetch is retried
+	mirrorRefreshRetry = 1 * time.Minute
+
+	// Timeout for fetching a metalink or mirror list
+	mirrorSourceTimeout = 30 * time.Second
+)
+
+// mirrorSource discovers the mirrors of a repository from a metalink or a
+// mirror list. The document is fetched when the mirrors are first needed and
+// refreshed in the background once it is older than the refresh interval.
+// Until a refresh succeeded, the previous mirrors are kept.
+type mirrorSource struct {
+	repo       string
+	url        string
+	metalink   bool
+	mirrorPath string
+	refresh    time.Duration
+
+	checksums *repodata.Store
+	// reports whether a URI is repository metadata, whose metalink
+	// checksums aren't used
+	isMetadata func(string) bool
+	transport  http.RoundTripper
+
+	// held while the document is fetched
+	fetchMu sync.Mutex
+
+	mu        sync.RWMutex
+	list      []*url.URL
+	attempted bool
+	next      time.Time
+}
+
+// get returns the discovered mirrors. The first call blocks until the
+// document was fetched.
+func (s *mirrorSource) get() []*url.URL {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	list, attempted, next := s.list, s.attempted, s.next
+	s.mu.RUnlock()
+
+	if !attempted {
+		s.fetchMu.Lock()
+		defer s.fetchMu.Unlock()
+		s.mu.RLock()
+		attempted = s.attempted
+		s.mu.RUnlock()
+		if !attempted {
+			s.update()
+		}
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return s.list
+	}
+	if time.Now().After(next) && s.fetchMu.TryLock() {
+		go func() {
+			defer s.fetchMu.Unlock()
+			s.update()
+		}()
+	}
+	return list
+}
+
+// update fetches the document and replaces the discovered mirrors. The caller
+// must hold s.fetchMu.
+func (s *mirrorSource) update() {
+	list, err := s.fetch()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempted = true
+	if err != nil {
+		slog.Error("mirror list fetch failed", "repository", s.repo, "url", s.url, "error", err)
+		s.next = time.Now().Add(mirrorRefreshRetry)
+		return
+	}
+	if len(list) == 0 {
+		slog.Warn("mirror list contains no usable mirrors", "repository", s.repo, "url", s.url, "mirror_path", s.mirrorPath)
+	} else {
+		slog.Info("mirror list updated", "repository", s.repo, "url", s.url, "mirrors", len(list))
+	}
+	s.list = list
+	s.next = time.Now().Add(s.refresh)
+}
+
+// fetch downloads and parses the document and returns the base URLs of the
+// mirrors it lists. The checksums of the files listed in a metalink are added
+// to the checksum store, except for repository metadata: the metalink may be
+// older than the metadata on the mirrors, which would then be rejected.
+func (s *mirrorSource) fetch() ([]*url.URL, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), mirrorSourceTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	rsp, err := (&http.Client{Transport: s.transport}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response: %s", rsp.Status)
+	}
+
+	var urls []string
+	if s.metalink {
+		files, err := repodata.ParseMetalink(rsp.Body)
+		if err != nil {
+			return nil, err
+		}
+		base := path.Join("/", s.repo, s.mirrorPath)
+		checksums := map[string]string{}
+		for _, file := range files {
+			if file.SHA256 != "" && (s.isMetadata == nil || !s.isMetadata(path.Join(base, file.Name))) {
+				checksums[file.Name] = file.SHA256
+			}
+			for _, u := range file.URLs {
+				// the metalink points to the file, the mirror path to its
+				// directory
+				urls = append(urls, u[:strings.LastIndex(u, "/")+1])
+			}
+		}
+		s.checksums.Update(s.url, base, checksums)
+	} else {
+		if urls, err = repodata.ParseMirrorlist(rsp.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	var list []*url.URL
+	seen := map[string]bool{}
+	for _, u := range urls {
+		mirror, ok := mirrorBaseURL(u, s.mirrorPath)
+		if !ok || seen[mirror.String()] {
+			continue
+		}
+		seen[mirror.String()] = true
+		list = append(list, mirror)
+	}
+	return list, nil
+}
+
+// mirrorBaseURL returns the base URL of the mirror by stripping the mirror
+// path from the directory URL u. It returns false if u doesn't end with the
+// mirror path.
+func mirrorBaseURL(u string, mirrorPath string) (*url.URL, bool) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, false
+	}
+	dir := strings.TrimSuffix(parsed.Path, "/")
+	if suffix := strings.Trim(mirrorPath, "/"); suffix != "" {
+		var ok bool
+		if dir, ok = strings.CutSuffix(dir, "/"+suffix); !ok {
+			return nil, false
+		}
+	}
+	parsed.Path = dir + "/"
+	parsed.RawPath = ""
+	parsed.RawQuery = ""
+	parsed.Fragment = ""
+	return parsed, true
+}
+
+// mirrorList returns the mirrors of repo: the discovered mirrors followed by
+// the statically configured ones.
+func (pp *pkgProxy) mirrorList(repo string) []*url.URL {
+	up := pp.upstreams[repo]
+	discovered := up.source.get()
+	if len(discovered) == 0 {
+		return up.mirrors
+	}
+	list := make([]*url.URL, 0, len(discovered)+len(up.mirrors))
+	seen := map[string]bool{}
+	for _, mirror := range slices.Concat(discovered, up.mirrors) {
+		if !seen[mirror.String()] {
+			seen[mirror.String()] = true
+			list = append(list, mirror)
+		}
+	}
+	return list
+}
@@ -0,0 +1,190 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package pkgproxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirrorBaseURL(t *testing.T) {
+	tests := []struct {
+		url        string
+		mirrorPath string
+		base       string
+		ok         bool
+	}{
+		{"https://mirror.example.com/fedora/linux/releases/42/Everything/x86_64/os/repodata/", "releases/42/Everything/x86_64/os/repodata", "https://mirror.example.com/fedora/linux/", true},
+		{"https://mirror.example.com/rocky/9.5/BaseOS/x86_64/os", "/9.5/BaseOS/x86_64/os/", "https://mirror.example.com/rocky/", true},
+		{"https://mirror.example.com/rocky/9.5/BaseOS/x86_64/os/", "", "https://mirror.example.com/rocky/9.5/BaseOS/x86_64/os/", true},
+		{"https://mirror.example.com/other/path/", "9.5/BaseOS/x86_64/os", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			base, ok := mirrorBaseURL(tt.url, tt.mirrorPath)
+			assert.Equal(t, tt.ok, ok)
+			if ok {
+				assert.Equal(t, tt.base, base.String())
+			}
+		})
+	}
+}
+
+func TestMetalinkMirrors(t *testing.T) {
+	repomd := "<repomd/>"
+	sum := sha256.Sum256([]byte(repomd))
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/fedora/releases/42/os/repodata/repomd.xml" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, repomd)
+	}))
+	defer mirror.Close()
+	metalink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?>
+<metalink version="3.0" xmlns="http://www.metalinker.org/">
+ <files>
+  <file name="repomd.xml">
+   <verification><hash type="sha256">%s</hash></verification>
+   <resources>
+    <url protocol="https" preference="90">https://unrelated.example.com/path/repomd.xml</url>
+    <url protocol="http" preference="100">%s/fedora/releases/42/os/repodata/repomd.xml</url>
+   </resources>
+  </file>
+ </files>
+</metalink>`, hex.EncodeToString(sum[:]), mirror.URL)
+	}))
+	defer metalink.Close()
+
+	pp, _ := newTestProxyWithRepo(t, Repository{
+		Metalink:   metalink.URL + "/metalink?repo=fedora-42",
+		MirrorPath: "releases/42/os/repodata",
+		Mirrors:    []string{"http://fallback.example.com/fedora/"},
+	})
+
+	var mirrors []string
+	for _, u := range pp.mirrorList("testrepo") {
+		mirrors = append(mirrors, u.String())
+	}
+	assert.Equal(t, []string{mirror.URL + "/fedora/", "http://fallback.example.com/fedora/"}, mirrors)
+
+	checksum, ok := pp.checksums.Lookup("/testrepo/releases/42/os/repodata/repomd.xml")
+	assert.True(t, ok)
+	assert.Equal(t, hex.EncodeToString(sum[:]), checksum)
+
+	app := newTestApp(pp)
+	req := httptest.NewRequest(http.MethodGet, "/testrepo/releases/42/os/repodata/repomd.xml", nil)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, repomd, rec.Body.String())
+}
+
+func TestMetalinkMetadataChanged(t *testing.T) {
+	var repomd atomic.Value
+	repomd.Store("<repomd>1</repomd>")
+	published := sha256.Sum256([]byte("<repomd>1</repomd>"))
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, repomd.Load())
+	}))
+	defer mirror.Close()
+	metalink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?>
+<metalink version="3.0" xmlns="http://www.metalinker.org/">
+ <files>
+  <file name="repomd.xml">
+   <verification><hash type="sha256">%s</hash></verification>
+   <resources>
+    <url protocol="http" preference="100">%s/fedora/releases/42/os/repodata/repomd.xml</url>
+   </resources>
+  </file>
+ </files>
+</metalink>`, hex.EncodeToString(published[:]), mirror.URL)
+	}))
+	defer metalink.Close()
+
+	pp, cacheDir := newTestProxyWithRepo(t, Repository{
+		Metalink:   metalink.URL,
+		MirrorPath: "releases/42/os/repodata",
+		Metadata:   &MetadataConfig{Patterns: []string{"repomd.xml"}},
+	})
+	require.Len(t, pp.mirrorList("testrepo"), 1)
+
+	// the metadata on the mirror was updated after the metalink was fetched
+	repomd.Store("<repomd>2</repomd>")
+	_, ok := pp.checksums.Lookup("/testrepo/releases/42/os/repodata/repomd.xml")
+	assert.False(t, ok)
+
+	rec := httptest.NewRecorder()
+	newTestApp(pp).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/testrepo/releases/42/os/repodata/repomd.xml", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "<repomd>2</repomd>", rec.Body.String())
+	assert.FileExists(t, filepath.Join(cacheDir, "testrepo", "releases", "42", "os", "repodata", "repomd.xml"))
+}
+
+func TestMirrorlistRefresh(t *testing.T) {
+	var version atomic.Int32
+	mirrorlist := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "# mirrorlist\nhttps://mirror%d.example.com/rocky/9/BaseOS/x86_64/os/\n", version.Load())
+	}))
+	defer mirrorlist.Close()
+
+	pp, _ := newTestProxyWithRepo(t, Repository{
+		Mirrorlist:    mirrorlist.URL,
+		MirrorPath:    "9/BaseOS/x86_64/os",
+		MirrorRefresh: time.Millisecond,
+	})
+	require.Len(t, pp.mirrorList("testrepo"), 1)
+	assert.Equal(t, "https://mirror0.example.com/rocky/", pp.mirrorList("testrepo")[0].String())
+
+	version.Store(1)
+	assert.Eventually(t, func() bool {
+		mirrors := pp.mirrorList("testrepo")
+		return len(mirrors) == 1 && mirrors[0].String() == "https://mirror1.example.com/rocky/"
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestMirrorlistFetchFailure(t *testing.T) {
+	var fail atomic.Bool
+	mirrorlist := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "https://mirror.example.com/rocky/")
+	}))
+	defer mirrorlist.Close()
+
+	pp, _ := newTestProxyWithRepo(t, Repository{
+		Mirrorlist: mirrorlist.URL,
+		Mirrors:    []string{"https://static.example.com/rocky/"},
+	})
+	source := pp.upstreams["testrepo"].source
+	require.Len(t, pp.mirrorList("testrepo"), 2)
+
+	// a failed refresh keeps the previous mirrors
+	fail.Store(true)
+	source.fetchMu.Lock()
+	source.update()
+	source.fetchMu.Unlock()
+	assert.Len(t, pp.mirrorList("testrepo"), 2)
+
+	// without discovered mirrors, the static mirrors are used
+	source.mu.Lock()
+	source.list = nil
+	source.mu.Unlock()
+	mirrors := pp.mirrorList("testrepo")
+	require.Len(t, mirrors, 1)
+	assert.Equal(t, "https://static.example.com/rocky/", mirrors[0].String())
+}
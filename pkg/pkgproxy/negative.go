@@ -0,0 +1,83 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package pkgproxy
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Maximum number of URIs remembered by the negative cache
+var negativeCacheSize = 10000
+
+// negativeCache remembers the URIs for which all mirrors returned 404, so
+// that repeated requests are answered without contacting upstream. Entries
+// expire after the TTL given when they were added. Once the cache is full,
+// the oldest entries are dropped.
+type negativeCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // front: oldest
+	entries map[string]*list.Element
+}
+
+type negativeEntry struct {
+	uri     string
+	expires time.Time
+}
+
+func newNegativeCache(size int) *negativeCache {
+	return &negativeCache{
+		size:    size,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+// add remembers that uri doesn't exist upstream for the given TTL.
+func (n *negativeCache) add(uri string, ttl time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if el, ok := n.entries[uri]; ok {
+		n.order.Remove(el)
+	}
+	n.entries[uri] = n.order.PushBack(&negativeEntry{uri: uri, expires: time.Now().Add(ttl)})
+	for n.order.Len() > n.size {
+		n.evict(n.order.Front())
+	}
+}
+
+// contains reports whether uri is known not to exist upstream.
+func (n *negativeCache) contains(uri string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	el, ok := n.entries[uri]
+	if !ok {
+		return false
+	}
+	if time.Now().After(el.Value.(*negativeEntry).expires) {
+		n.evict(el)
+		return false
+	}
+	return true
+}
+
+// remove forgets uri and reports whether it was known.
+func (n *negativeCache) remove(uri string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	el, ok := n.entries[uri]
+	if !ok {
+		return false
+	}
+	expired := time.Now().After(el.Value.(*negativeEntry).expires)
+	n.evict(el)
+	return !expired
+}
+
+// evict drops an entry. The caller must hold n.mu.
+func (n *negativeCache) evict(el *list.Element) {
+	entry := n.order.Remove(el).(*negativeEntry)
+	delete(n.entries, entry.uri)
+}
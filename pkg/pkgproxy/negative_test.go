@@ -0,0 +1,117 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package pkgproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegativeCache(t *testing.T) {
+	n := newNegativeCache(2)
+	n.add("/repo/a", time.Hour)
+	n.add("/repo/b", time.Hour)
+	assert.True(t, n.contains("/repo/a"))
+	assert.True(t, n.contains("/repo/b"))
+
+	// the oldest entry is dropped once the cache is full
+	n.add("/repo/c", time.Hour)
+	assert.False(t, n.contains("/repo/a"))
+	assert.True(t, n.contains("/repo/c"))
+
+	assert.True(t, n.remove("/repo/b"))
+	assert.False(t, n.remove("/repo/b"))
+	assert.False(t, n.contains("/repo/b"))
+}
+
+func TestNegativeCacheExpiry(t *testing.T) {
+	n := newNegativeCache(10)
+	n.add("/repo/a", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	assert.False(t, n.contains("/repo/a"))
+	assert.False(t, n.remove("/repo/a"))
+}
+
+func TestCacheNegativeCaching(t *testing.T) {
+	var requests atomic.Int32
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer mirror.Close()
+
+	pp, _ := newTestProxyWithRepo(t, Repository{Mirrors: []string{mirror.URL + "/", mirror.URL + "/other/"}, NegativeTTL: time.Hour})
+	app := newTestApp(pp)
+
+	// cache candidates and other files
+	for _, uri := range []string{"/testrepo/Packages/missing.rpm", "/testrepo/repodata/missing.xml"} {
+		requests.Store(0)
+		for range 3 {
+			req := httptest.NewRequest(http.MethodGet, uri, nil)
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusNotFound, rec.Code, uri)
+		}
+		assert.Equal(t, int32(2), requests.Load(), "expected only the first request to reach both mirrors: %s", uri)
+	}
+
+	// DELETE invalidates the entry
+	rec := adminRequest(app, http.MethodDelete, "/testrepo/Packages/missing.rpm", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	requests.Store(0)
+	req := httptest.NewRequest(http.MethodGet, "/testrepo/Packages/missing.rpm", nil)
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestCacheNegativeCachingPartialNotFound(t *testing.T) {
+	var requests atomic.Int32
+	notFound := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer notFound.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+
+	pp, _ := newTestProxyWithRepo(t, Repository{Mirrors: []string{failing.URL + "/", notFound.URL + "/"}, NegativeTTL: time.Hour})
+	app := newTestApp(pp)
+
+	for range 2 {
+		req := httptest.NewRequest(http.MethodGet, "/testrepo/Packages/missing.rpm", nil)
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	}
+	assert.Equal(t, int32(2), requests.Load(), "expected no negative caching if not all mirrors returned 404")
+}
+
+func TestCacheNegativeCachingDisabled(t *testing.T) {
+	var requests atomic.Int32
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer mirror.Close()
+
+	pp, _ := newTestProxyWithRepo(t, Repository{Mirrors: []string{mirror.URL + "/"}})
+	app := newTestApp(pp)
+
+	for range 2 {
+		req := httptest.NewRequest(http.MethodGet, "/testrepo/Packages/missing.rpm", nil)
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	}
+	assert.Equal(t, int32(2), requests.Load())
+}
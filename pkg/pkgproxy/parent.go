@@ -0,0 +1,79 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package pkgproxy
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Response header by which pkgproxy tells its clients whether a response
+	// of a repository may be cached. A child pkgproxy doesn't cache files
+	// marked with "false".
+	headerCacheable = "X-Pkgproxy-Cacheable"
+
+	// Mirror index of the parent pkgproxy in the logs
+	parentIndex = -1
+)
+
+var errNotCacheable = errors.New("not cacheable according to upstream")
+
+// isCacheable reports whether the upstream response may be cached.
+func isCacheable(header http.Header) bool {
+	return header.Get(headerCacheable) != "false"
+}
+
+// parentRequest prepares the request to the parent pkgproxy of repo. Unless
+// the client sent its own Cache-Control header, the parent is asked not to
+// serve metadata which was validated longer than max_age ago, so that the
+// freshness of the metadata doesn't add up across the tiers.
+func (pp *pkgProxy) parentRequest(req *http.Request, repo string) *http.Request {
+	up := pp.upstreams[repo]
+	if req.Header.Get("Cache-Control") != "" || !up.cache.IsMetadata(req.URL.Path) {
+		return req
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Cache-Control", "max-age="+strconv.Itoa(int(up.metadataMaxAge.Seconds())))
+	return req
+}
+
+// parentResponse marks a response of the parent pkgproxy as not cacheable if
+// the parent forbids storing it.
+func parentResponse(rsp *http.Response) {
+	for _, directive := range cacheControl(rsp.Header) {
+		if directive == "no-store" || directive == "private" {
+			rsp.Header.Set(headerCacheable, "false")
+		}
+	}
+}
+
+// requestMaxAge returns the maximum age of a cached response acceptable for
+// the client according to the Cache-Control request header.
+func requestMaxAge(header http.Header) (time.Duration, bool) {
+	for _, directive := range cacheControl(header) {
+		if directive == "no-cache" {
+			return 0, true
+		}
+		if value, ok := strings.CutPrefix(directive, "max-age="); ok {
+			if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+				return time.Duration(seconds) * time.Second, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// cacheControl returns the lower-case directives of the Cache-Control header.
+func cacheControl(header http.Header) []string {
+	var directives []string
+	for _, value := range header.Values("Cache-Control") {
+		for directive := range strings.SplitSeq(value, ",") {
+			directives = append(directives, strings.ToLower(strings.TrimSpace(directive)))
+		}
+	}
+	return directives
+}
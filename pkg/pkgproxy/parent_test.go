@@ -0,0 +1,274 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package pkgproxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingServer returns a server answering every request with content and
+// counting the requests.
+func countingServer(t *testing.T, content string, header http.Header) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var count atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		count.Add(1)
+		for name, value := range header {
+			w.Header()[name] = value
+		}
+		fmt.Fprint(w, content)
+	}))
+	t.Cleanup(server.Close)
+	return server, &count
+}
+
+func TestParentTriedFirst(t *testing.T) {
+	origin, originCount := countingServer(t, "package", nil)
+	mirror, mirrorCount := countingServer(t, "package", nil)
+
+	parentPP, parentDir := newTestProxy(t, []string{origin.URL + "/"})
+	parent := httptest.NewServer(newTestApp(parentPP))
+	defer parent.Close()
+
+	pp, cacheDir := newTestProxyWithRepo(t, Repository{
+		CacheSuffixes: []string{".rpm", ".xml"},
+		Mirrors:       []string{mirror.URL + "/"},
+		Parent:        parent.URL + "/testrepo/",
+	})
+	app := newTestApp(pp)
+
+	for range 2 {
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/testrepo/Packages/a.rpm", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "package", rec.Body.String())
+		assert.Equal(t, "true", rec.Header().Get(headerCacheable))
+	}
+	assert.Equal(t, int32(1), originCount.Load())
+	assert.Equal(t, int32(0), mirrorCount.Load(), "mirror must not be contacted while the parent is healthy")
+	assert.FileExists(t, filepath.Join(parentDir, "testrepo", "Packages", "a.rpm"))
+	assert.FileExists(t, filepath.Join(cacheDir, "testrepo", "Packages", "a.rpm"))
+}
+
+func TestParentUnreachable(t *testing.T) {
+	mirror, mirrorCount := countingServer(t, "package", nil)
+	parent := httptest.NewServer(http.NotFoundHandler())
+	parentURL := parent.URL + "/testrepo/"
+	parent.Close()
+
+	pp, cacheDir := newTestProxyWithRepo(t, Repository{
+		CacheSuffixes: []string{".rpm", ".xml"},
+		Mirrors:       []string{mirror.URL + "/"},
+		Parent:        parentURL,
+	})
+	app := newTestApp(pp)
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/testrepo/Packages/a.rpm", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "package", rec.Body.String())
+	assert.Equal(t, int32(1), mirrorCount.Load())
+	assert.FileExists(t, filepath.Join(cacheDir, "testrepo", "Packages", "a.rpm"))
+}
+
+func TestParentServerError(t *testing.T) {
+	mirror, _ := countingServer(t, "package", nil)
+	parent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer parent.Close()
+
+	pp, _ := newTestProxyWithRepo(t, Repository{
+		CacheSuffixes: []string{".rpm", ".xml"},
+		Mirrors:       []string{mirror.URL + "/"},
+		Parent:        parent.URL + "/testrepo/",
+	})
+	rec := httptest.NewRecorder()
+	newTestApp(pp).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/testrepo/Packages/a.rpm", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "package", rec.Body.String())
+}
+
+func TestParentServerErrorMirrorsOpen(t *testing.T) {
+	mirror, mirrorCount := countingServer(t, "package", nil)
+	var parentCount atomic.Int32
+	parent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		parentCount.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer parent.Close()
+
+	pp, _ := newTestProxyWithRepo(t, Repository{
+		CacheSuffixes: []string{".rpm", ".xml"},
+		Mirrors:       []string{mirror.URL + "/"},
+		Parent:        parent.URL + "/testrepo/",
+	})
+	up := pp.upstreams["testrepo"]
+	mirrorHealth := up.health.get(up.mirrors[0])
+	for range defaultFailureThreshold {
+		mirrorHealth.record(nil, errors.New("timeout"), false)
+	}
+	app := newTestApp(pp)
+
+	// the circuit of the mirror is open, so only the healthy parent is tried
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/testrepo/Packages/a.rpm", nil))
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Equal(t, int32(1), parentCount.Load())
+	assert.Equal(t, int32(0), mirrorCount.Load())
+
+	// the mirror is probed after the parent failed, regardless of the parent
+	// health
+	mirrorHealth.openUntil = time.Now()
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/testrepo/Packages/a.rpm", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "package", rec.Body.String())
+	assert.Equal(t, int32(2), parentCount.Load())
+	assert.Equal(t, int32(1), mirrorCount.Load())
+}
+
+func TestParentNotCacheable(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+	}{
+		{"cacheable header", http.Header{headerCacheable: {"false"}}},
+		{"no-store", http.Header{"Cache-Control": {"no-store"}}},
+		{"private", http.Header{"Cache-Control": {"private, max-age=60"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent, _ := countingServer(t, "package", tt.header)
+			pp, cacheDir := newTestProxyWithRepo(t, Repository{
+				CacheSuffixes: []string{".rpm", ".xml"},
+				Parent:        parent.URL + "/testrepo/",
+			})
+			rec := httptest.NewRecorder()
+			newTestApp(pp).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/testrepo/Packages/a.rpm", nil))
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, "package", rec.Body.String())
+			assert.Equal(t, "false", rec.Header().Get(headerCacheable))
+			assert.NoFileExists(t, filepath.Join(cacheDir, "testrepo", "Packages", "a.rpm"))
+		})
+	}
+}
+
+func TestParentExcludedFileNotCached(t *testing.T) {
+	origin, _ := countingServer(t, "package", nil)
+	parentPP := New(&PkgProxyConfig{
+		CacheBasePath: t.TempDir(),
+		RepositoryConfig: &RepoConfig{
+			Repositories: map[string]Repository{
+				"testrepo": {
+					CacheSuffixes: []string{".rpm"},
+					Exclude:       []string{"-debuginfo.rpm"},
+					Mirrors:       []string{origin.URL + "/"},
+				},
+			},
+		},
+	})
+	parent := httptest.NewServer(newTestApp(parentPP))
+	defer parent.Close()
+
+	pp, cacheDir := newTestProxyWithRepo(t, Repository{
+		CacheSuffixes: []string{".rpm", ".xml"},
+		Parent:        parent.URL + "/testrepo/",
+	})
+	rec := httptest.NewRecorder()
+	newTestApp(pp).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/testrepo/Packages/a-debuginfo.rpm", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "false", rec.Header().Get(headerCacheable))
+	assert.NoFileExists(t, filepath.Join(cacheDir, "testrepo", "Packages", "a-debuginfo.rpm"))
+}
+
+func TestParentMetadataMaxAge(t *testing.T) {
+	var cacheControl atomic.Value
+	parent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cacheControl.Store(r.Header.Get("Cache-Control"))
+		fmt.Fprint(w, "<repomd/>")
+	}))
+	defer parent.Close()
+
+	metadata := &MetadataConfig{Patterns: []string{"repomd.xml"}, MaxAge: 2 * time.Minute}
+	pp, _ := newTestProxyWithRepo(t, Repository{
+		CacheSuffixes: []string{".rpm", ".xml"},
+		Metadata:      metadata,
+		Parent:        parent.URL + "/testrepo/",
+	})
+	app := newTestApp(pp)
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/testrepo/repodata/repomd.xml", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "max-age=120", cacheControl.Load())
+
+	// the Cache-Control header of the client takes precedence
+	req := httptest.NewRequest(http.MethodGet, "/testrepo/repodata/other.xml", nil)
+	req.Header.Set("Cache-Control", "no-cache")
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "no-cache", cacheControl.Load())
+}
+
+func TestRevalidateRequestMaxAge(t *testing.T) {
+	mirror, count := countingServer(t, "<repomd/>", nil)
+	pp, _ := newTestProxyWithRepo(t, Repository{
+		Metadata: &MetadataConfig{Patterns: []string{"repomd.xml"}, MaxAge: time.Hour},
+		Mirrors:  []string{mirror.URL + "/"},
+	})
+	app := newTestApp(pp)
+
+	get := func(cacheControl string) {
+		req := httptest.NewRequest(http.MethodGet, "/testrepo/repodata/repomd.xml", nil)
+		if cacheControl != "" {
+			req.Header.Set("Cache-Control", cacheControl)
+		}
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+	}
+	get("")
+	get("max-age=600")
+	assert.Equal(t, int32(1), count.Load(), "metadata is fresh enough for the client")
+	get("no-cache")
+	assert.Equal(t, int32(2), count.Load(), "no-cache forces a revalidation")
+	get("max-age=0")
+	assert.Equal(t, int32(3), count.Load(), "max-age=0 forces a revalidation")
+}
+
+func TestRequestMaxAge(t *testing.T) {
+	tests := []struct {
+		value  string
+		maxAge time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"no-cache", 0, true},
+		{"No-Cache", 0, true},
+		{"max-age=300", 5 * time.Minute, true},
+		{"no-transform, max-age=60", time.Minute, true},
+		{"max-age=-1", 0, false},
+		{"max-stale=60", 0, false},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.value != "" {
+			header.Set("Cache-Control", tt.value)
+		}
+		maxAge, ok := requestMaxAge(header)
+		assert.Equal(t, tt.ok, ok, tt.value)
+		assert.Equal(t, tt.maxAge, maxAge, tt.value)
+	}
+}
@@ -5,47 +5,88 @@ package pkgproxy
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/ganto/pkgproxy/pkg/cache"
+	"github.com/ganto/pkgproxy/pkg/repodata"
 	"github.com/ganto/pkgproxy/pkg/utils"
 	echo "github.com/labstack/echo/v5"
 )
 
 type (
 	PkgProxy interface {
+		Admin(*echo.Group)
 		Cache(echo.HandlerFunc) echo.HandlerFunc
 		ForwardProxy(echo.HandlerFunc) echo.HandlerFunc
+		MetricsHandler() http.Handler
+		RewriteProxyRequest(echo.HandlerFunc) echo.HandlerFunc
 	}
 
 	PkgProxyConfig struct {
 		CacheBasePath    string
 		RepositoryConfig *RepoConfig
 
+		// Cached files may be deleted with DELETE requests carrying
+		// AdminToken as bearer token or sent from one of DeleteTrusted.
+		// DisableDelete rejects all DELETE requests.
+		AdminToken    string
+		DeleteTrusted []*net.IPNet
+		DisableDelete bool
+
+		// Serve all repositories exclusively from the cache
+		Offline bool
+
+		// Local file system base path for storing repository snapshots.
+		// Snapshots are disabled if empty.
+		SnapshotBasePath string
+
+		// Backend storing the cached files. The files are stored below
+		// CacheBasePath if nil.
+		Storage cache.Storage
+
 		// To customize the transport to remote.
 		// Examples: If custom TLS certificates are required.
 		Transport http.RoundTripper
 	}
 
 	pkgProxy struct {
+		checksums      *repodata.Store
+		deleteAuth     *deleteAuth
+		downloads      *downloads
+		metrics        *metrics
+		notFound       *negativeCache
+		snapshots      *cache.SnapshotStore
 		transport      http.RoundTripper
 		upstreams      map[string]upstream
 		retryBaseDelay time.Duration
 	}
 	upstream struct {
-		cache   cache.FileCache
-		mirrors []*url.URL
-		retries int
+		access         *accessControl
+		auth           *upstreamAuth
+		cache          cache.FileCache
+		health         *mirrorHealthSet
+		metadataMaxAge time.Duration
+		mirrors        []*url.URL
+		negativeTTL    time.Duration
+		offline        bool
+		orderByLatency bool
+		parent         *url.URL
+		retries        int
+		source         *mirrorSource
+		staleIfError   time.Duration
+		transport      http.RoundTripper
 	}
 )
 
@@ -74,6 +115,8 @@ var (
 		"Authorization",
 		"Cache-Control",
 		"Cookie",
+		"If-Modified-Since",
+		"If-None-Match",
 		"Range",
 		"Referer",
 		"User-Agent",
@@ -98,12 +141,25 @@ var (
 		"Vary",
 	}
 
+	// HTTP request headers that make a request conditional
+	conditionalRequestHeaders = []string{
+		"If-Modified-Since",
+		"If-None-Match",
+	}
+
 	// Default number of attempts per mirror (1 = no retry)
 	defaultRetries = 1
 
+	// Default time after which cached repository metadata is revalidated
+	defaultMetadataMaxAge = 5 * time.Minute
+
 	// Base delay for exponential backoff between retry attempts (1s, 2s, 4s, ...)
 	retryBaseDelay = 1 * time.Second
 
+	// Timeout for fetching a file in the background, which isn't bounded by
+	// a client request
+	downloadTimeout = 30 * time.Minute
+
 	// Status codes which will trigger a new request to the "Location" header
 	redirectStatusCodes = []int{
 		301,
@@ -120,6 +176,8 @@ func New(config *PkgProxyConfig) PkgProxy {
 		transport = http.DefaultTransport
 	}
 
+	evictor := cache.NewEvictor(config.CacheBasePath, int64(config.RepositoryConfig.MaxSize))
+	checksums := repodata.NewStore()
 	upstreams := map[string]upstream{}
 	for _, repo := range utils.KeysFromMap(config.RepositoryConfig.Repositories) {
 		var mirrors []*url.URL
@@ -129,24 +187,126 @@ func New(config *PkgProxyConfig) PkgProxy {
 				mirrors = append(mirrors, url)
 			}
 		}
+		upstreamProxy := config.RepositoryConfig.Repositories[repo].UpstreamProxy
+		if upstreamProxy == "" {
+			upstreamProxy = config.RepositoryConfig.UpstreamProxy
+		}
+		repoTransport, err := newTransport(transport, config.RepositoryConfig.Repositories[repo].Transport, upstreamProxy)
+		if err != nil {
+			slog.Error("upstream transport failed", "repository", repo, "error", err)
+			repoTransport = transport
+		}
+		var access *accessControl
+		if accessConfig := config.RepositoryConfig.Repositories[repo].Access; accessConfig != nil {
+			if access, err = newAccessControl(accessConfig); err != nil {
+				// reject all clients rather than serving the repository unprotected
+				slog.Error("access control failed", "repository", repo, "error", err)
+				access = &accessControl{requireAuth: true}
+			}
+		}
+		var auth *upstreamAuth
+		if authConfig := config.RepositoryConfig.Repositories[repo].Auth; authConfig != nil {
+			if auth, err = newUpstreamAuth(authConfig, mirrors, repoTransport); err != nil {
+				slog.Error("upstream auth failed", "repository", repo, "error", err)
+			}
+		}
+		var parent *url.URL
+		if value := config.RepositoryConfig.Repositories[repo].Parent; value != "" {
+			if url, err := url.Parse(value); err == nil {
+				parent = url
+			}
+		}
 		retries := config.RepositoryConfig.Repositories[repo].Retries
 		if retries < 1 {
 			retries = defaultRetries
 		}
+		metadataMaxAge := defaultMetadataMaxAge
+		var staleIfError time.Duration
+		if metadata := config.RepositoryConfig.Repositories[repo].Metadata; metadata != nil {
+			if metadata.MaxAge > 0 {
+				metadataMaxAge = metadata.MaxAge
+			}
+			staleIfError = metadata.StaleIfError
+		}
+		threshold, coolOff, orderByLatency := defaultFailureThreshold, defaultCoolOff, false
+		if mirrorHealth := config.RepositoryConfig.Repositories[repo].MirrorHealth; mirrorHealth != nil {
+			if mirrorHealth.FailureThreshold > 0 {
+				threshold = mirrorHealth.FailureThreshold
+			}
+			if mirrorHealth.CoolOff > 0 {
+				coolOff = mirrorHealth.CoolOff
+			}
+			orderByLatency = mirrorHealth.OrderByLatency
+		}
+		repoConfig := config.RepositoryConfig.Repositories[repo]
+		offline := config.Offline || repoConfig.Offline
+		cacheConfig := repoConfig.CacheConfig(config.CacheBasePath)
+		cacheConfig.Evictor = evictor
+		cacheConfig.Deduplicate = config.RepositoryConfig.Deduplicate
+		cacheConfig.Storage = config.Storage
+		repoCache := cache.New(cacheConfig)
+		var source *mirrorSource
+		if !offline && (repoConfig.Metalink != "" || repoConfig.Mirrorlist != "") {
+			source = &mirrorSource{
+				repo:       repo,
+				url:        repoConfig.Metalink + repoConfig.Mirrorlist,
+				metalink:   repoConfig.Metalink != "",
+				mirrorPath: repoConfig.MirrorPath,
+				refresh:    repoConfig.MirrorRefresh,
+				checksums:  checksums,
+				isMetadata: repoCache.IsMetadata,
+				transport:  repoTransport,
+			}
+			if source.refresh == 0 {
+				source.refresh = defaultMirrorRefresh
+			}
+			// fetch the mirror list before the first request needs it
+			go source.get()
+		}
 		upstreams[repo] = upstream{
-			cache: cache.New(&cache.CacheConfig{
-				BasePath:     config.CacheBasePath,
-				FileSuffixes: config.RepositoryConfig.Repositories[repo].CacheSuffixes,
-				Exclude:      config.RepositoryConfig.Repositories[repo].Exclude,
-			}),
-			mirrors: mirrors,
-			retries: retries,
+			access:         access,
+			auth:           auth,
+			cache:          repoCache,
+			health:         newMirrorHealthSet(repo, threshold, coolOff),
+			metadataMaxAge: metadataMaxAge,
+			mirrors:        mirrors,
+			negativeTTL:    repoConfig.NegativeTTL,
+			offline:        offline,
+			orderByLatency: orderByLatency,
+			parent:         parent,
+			retries:        retries,
+			source:         source,
+			staleIfError:   staleIfError,
+			transport:      repoTransport,
+		}
+		evictor.SetLimit(repo, int64(config.RepositoryConfig.Repositories[repo].MaxSize))
+	}
+	// Register the files which are already cached to report the cache size
+	// and enforce the quotas. Until the scan is complete, only newly written
+	// files are subject to eviction.
+	go func() {
+		if err := evictor.Scan(); err != nil {
+			slog.Error("cache scan failed", "path", config.CacheBasePath, "error", err)
 		}
+	}()
+	var snapshots *cache.SnapshotStore
+	if config.SnapshotBasePath != "" {
+		snapshots = cache.NewSnapshotStore(config.SnapshotBasePath)
 	}
 	return &pkgProxy{
+		checksums:      checksums,
+		downloads:      newDownloads(),
+		metrics:        newMetrics(evictor, utils.KeysFromMap(upstreams)),
+		notFound:       newNegativeCache(negativeCacheSize),
+		snapshots:      snapshots,
 		transport:      transport,
 		upstreams:      upstreams,
 		retryBaseDelay: retryBaseDelay,
+		deleteAuth: &deleteAuth{
+			disabled: config.DisableDelete,
+			token:    config.AdminToken,
+			trusted:  config.DeleteTrusted,
+		},
 	}
 }
 
@@ -157,41 +317,115 @@ func (pp *pkgProxy) Cache(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c *echo.Context) error {
 		var repoCache cache.FileCache
 		var rw *resilientWriter
+		var dl *download
+
+		// Clients are checked before anything is served, fetched or
+		// deleted. The access control removes the client credentials, so
+		// DELETE is authorized with the header as sent by the client.
+		authorization := c.Request().Header.Get("Authorization")
+		if rejected, err := pp.checkAccess(c); rejected {
+			return err
+		}
+		deletedBy, rejected, err := pp.authorizeDelete(c, authorization)
+		if rejected {
+			return err
+		}
+
+		// Snapshot metadata is served from the snapshot store, all other
+		// requests continue with the URI of the repository.
+		if served, err := pp.resolveSnapshot(c); served || err != nil {
+			return err
+		}
 
 		// the request URI might be changed later, keep the original value
 		uri := strings.Clone(c.Request().RequestURI)
+		repo := getRepoFromURI(uri)
 
 		if pp.isRepositoryRequest(uri) {
 			if !utils.Contains(allowedCacheMethods, c.Request().Method) {
 				return c.JSON(http.StatusMethodNotAllowed, map[string]string{jsonKeyMessage: fmt.Sprintf("Cache does not allow method %s\n", c.Request().Method)})
 			}
-			repoCache = pp.upstreams[getRepoFromURI(uri)].cache
+			repoCache = pp.upstreams[repo].cache
+			// lookups are canceled together with the client request
+			lookup := repoCache.WithContext(c.Request().Context())
+
+			if c.Request().Method == httpMethodDelete && pp.notFound.remove(c.Request().URL.RequestURI()) {
+				slog.Info("negative cache delete", "request_id", requestID(c), "uri", uri, "remote_ip", c.RealIP(), "authorized_by", deletedBy)
+				if !repoCache.IsCacheCandidate(uri) || !lookup.IsCached(uri) {
+					return c.JSON(http.StatusOK, map[string]string{jsonKeyMessage: "Success"})
+				}
+			}
 
 			if repoCache.IsCacheCandidate(uri) {
-				if repoCache.IsCached(uri) {
+				if lookup.IsCached(uri) {
 					// serve or delete from cache
 					if c.Request().Method == httpMethodDelete {
-						slog.Info("cache delete", "request_id", requestID(c), "uri", uri)
+						slog.Info("cache delete", "request_id", requestID(c), "uri", uri, "remote_ip", c.RealIP(), "authorized_by", deletedBy)
 						if err := repoCache.DeleteFile(uri); err != nil {
 							return c.JSON(http.StatusInternalServerError, map[string]string{jsonKeyMessage: err.Error()})
 						}
 						return c.JSON(http.StatusOK, map[string]string{jsonKeyMessage: "Success"})
 					}
-					filePath, err := repoCache.GetFilePath(uri)
-					if err != nil {
-						return c.JSON(http.StatusForbidden, map[string]string{jsonKeyMessage: "Forbidden"})
-					}
-					absPath, err := filepath.Abs(filePath)
-					if err != nil {
-						return c.JSON(http.StatusInternalServerError, map[string]string{jsonKeyMessage: err.Error()})
+					pp.metrics.cacheHits.WithLabelValues(repo).Inc()
+					// stale metadata is served as is while offline
+					if repoCache.IsMetadata(uri) && !pp.upstreams[repo].offline {
+						if served, err := pp.revalidate(c, repo, uri); served || err != nil {
+							return err
+						}
 					}
-					return c.FileFS(filepath.Base(absPath), os.DirFS(filepath.Dir(absPath)))
+					return pp.serveCached(c, repoCache, uri)
 				} else {
 					if c.Request().Method == httpMethodDelete {
 						return c.JSON(http.StatusNotFound, map[string]string{jsonKeyMessage: "Not Found"})
 					}
+					pp.metrics.cacheMisses.WithLabelValues(repo).Inc()
+					if pp.upstreams[repo].offline {
+						return offlineMiss(c, repo, uri)
+					}
+					if pp.isNotFound(c, repo) {
+						return c.JSON(http.StatusNotFound, map[string]string{jsonKeyMessage: "Not Found"})
+					}
+					if c.Request().Method == http.MethodGet {
+						var leader bool
+						dl, leader = pp.downloads.acquire(uri)
+						if !leader {
+							if served, err := pp.serveDownload(c, repoCache, dl, uri); served || err != nil {
+								return err
+							}
+							// the other download failed, fetch the file without
+							// caching, but never unverified
+							if checksum, ok := pp.checksums.Lookup(uri); ok {
+								return pp.fetchVerified(c, repoCache, repo, uri, checksum, nil)
+							}
+							return next(c)
+						}
+						if lookup.IsCached(uri) {
+							// committed by a download that finished in the meantime
+							pp.downloads.release(uri, dl, true)
+							return pp.serveCached(c, repoCache, uri)
+						}
+						if checksum, ok := pp.checksums.Lookup(uri); ok {
+							return pp.fetchVerified(c, repoCache, repo, uri, checksum, dl)
+						}
+						if c.Request().Header.Get("Range") != "" {
+							// Fetch the complete file in the background and serve
+							// the requested ranges from the temp file. The fetch
+							// must not be aborted when this client disconnects.
+							go pp.fetchDownload(c.Request().Clone(context.Background()), requestID(c), repo, uri, dl)
+							if served, err := pp.serveDownload(c, repoCache, dl, uri); served || err != nil {
+								return err
+							}
+							return next(c)
+						}
+					}
+					// A conditional request could be answered with 304 by the
+					// upstream server which leaves nothing to be cached.
+					for _, name := range conditionalRequestHeaders {
+						c.Request().Header.Del(name)
+					}
 					// Stream response to both client and cache temp file
 					rw = newResilientWriter(repoCache, uri)
+					rw.download = dl
 					if resp, _ := echo.UnwrapResponse(c.Response()); resp != nil {
 						sw := newSafeWriter(resp.ResponseWriter)
 						bodyWriter := io.MultiWriter(sw, rw)
@@ -199,6 +433,7 @@ func (pp *pkgProxy) Cache(next echo.HandlerFunc) echo.HandlerFunc {
 							Writer:         bodyWriter,
 							ResponseWriter: resp.ResponseWriter,
 							safe:           sw,
+							download:       dl,
 						}
 						resp.ResponseWriter = writer
 					}
@@ -224,6 +459,15 @@ func (pp *pkgProxy) Cache(next echo.HandlerFunc) echo.HandlerFunc {
 			}()
 		}
 
+		// Wake up concurrent requests waiting for this download. This must
+		// run before the temp file cleanup above.
+		complete := false
+		if dl != nil {
+			defer func() {
+				pp.downloads.release(uri, dl, complete)
+			}()
+		}
+
 		if err := next(c); err != nil {
 			return err
 		}
@@ -237,7 +481,7 @@ func (pp *pkgProxy) Cache(next echo.HandlerFunc) echo.HandlerFunc {
 			}
 
 			resp, _ := echo.UnwrapResponse(c.Response())
-			if repoCache.IsCacheCandidate(uri) && !repoCache.IsCached(uri) && resp != nil && resp.Status == 200 && rw.bytesWritten > 0 && !rw.failed {
+			if repoCache.IsCacheCandidate(uri) && !repoCache.IsCached(uri) && resp != nil && resp.Status == 200 && rw.bytesWritten > 0 && !rw.failed && isCacheable(c.Response().Header()) {
 				// Content-Length validation
 				commitOK := true
 				if clHeader := c.Response().Header().Get("Content-Length"); clHeader != "" {
@@ -246,12 +490,14 @@ func (pp *pkgProxy) Cache(next echo.HandlerFunc) echo.HandlerFunc {
 							slog.Warn("cache write skipped: Content-Length mismatch",
 								"request_id", requestID(c), "uri", uri,
 								"expected", expectedLen, "actual", rw.bytesWritten)
+							pp.metrics.cacheCommitFailures.WithLabelValues(repo).Inc()
 							commitOK = false
 						}
 					}
 				}
 
 				if commitOK {
+					complete = true
 					timestamp := time.Now().Local()
 					if c.Response().Header().Get("Last-Modified") != "" {
 						timestamp, _ = http.ParseTime(c.Response().Header().Get("Last-Modified"))
@@ -260,6 +506,13 @@ func (pp *pkgProxy) Cache(next echo.HandlerFunc) echo.HandlerFunc {
 					if err := repoCache.CommitTempFile(rw.TmpPath(), uri, timestamp); err != nil {
 						// don't fail request if we cannot write to cache
 						slog.Error("cache commit failed", "request_id", requestID(c), "uri", uri, "error", err)
+						pp.metrics.cacheCommitFailures.WithLabelValues(repo).Inc()
+					} else {
+						pp.metrics.cacheCommits.WithLabelValues(repo).Inc()
+						if repoCache.IsMetadata(uri) {
+							storeValidators(repoCache, requestID(c), uri, c.Response().Header())
+						}
+						pp.indexMetadata(requestID(c), repoCache, uri)
 					}
 				}
 			}
@@ -269,11 +522,125 @@ func (pp *pkgProxy) Cache(next echo.HandlerFunc) echo.HandlerFunc {
 	}
 }
 
+// serveCached serves the cached file for uri to the client.
+func (pp *pkgProxy) serveCached(c *echo.Context, fc cache.FileCache, uri string) error {
+	f, err := fc.WithContext(c.Request().Context()).Open(uri)
+	if errors.Is(err, fs.ErrNotExist) {
+		return echo.ErrNotFound
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{jsonKeyMessage: err.Error()})
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{jsonKeyMessage: err.Error()})
+	}
+	if info.IsDir() {
+		return echo.ErrNotFound
+	}
+	pp.indexMetadata(requestID(c), fc, uri)
+	// protect the file from eviction while it is being served
+	release := fc.Pin(uri)
+	defer release()
+	c.Response().Header().Set(headerCacheable, "true")
+	defer pp.metrics.countServed(c, getRepoFromURI(uri), sourceCache, responseSize(c))
+	http.ServeContent(c.Response(), c.Request(), info.Name(), info.ModTime(), f)
+	return nil
+}
+
+// serveDownload serves the request from the temp file of a concurrent request
+// that is fetching the same URI from upstream. It returns false if the other
+// download failed and the caller has to fetch the file on its own.
+func (pp *pkgProxy) serveDownload(c *echo.Context, fc cache.FileCache, dl *download, uri string) (bool, error) {
+	ctx := c.Request().Context()
+	rid := requestID(c)
+
+	status, header, err := dl.waitHeader(ctx)
+	if err != nil {
+		return true, err
+	}
+	if status != http.StatusOK {
+		slog.Info("cache attach failed", "request_id", rid, "uri", uri, "status", status)
+		return false, nil
+	}
+	f, err := dl.open(ctx)
+	if err != nil {
+		return true, err
+	}
+	if f == nil {
+		if dl.isComplete() && fc.WithContext(ctx).IsCached(uri) {
+			return true, pp.serveCached(c, fc, uri)
+		}
+		slog.Info("cache attach failed", "request_id", rid, "uri", uri, "status", status)
+		return false, nil
+	}
+	defer f.Close()
+
+	slog.Info("cache attach", "request_id", rid, "uri", uri)
+	for name, value := range filterHeaders(header, allowedResponseHeaders) {
+		c.Response().Header()[name] = value
+	}
+	// set by http.ServeContent according to the requested range
+	c.Response().Header().Del("Content-Length")
+	c.Response().Header().Set(headerCacheable, "true")
+	modtime, _ := http.ParseTime(header.Get("Last-Modified"))
+	defer pp.metrics.countServed(c, getRepoFromURI(uri), sourceCache, responseSize(c))
+	http.ServeContent(c.Response(), c.Request(), utils.FilenameFromURI(uri), modtime, newDownloadReader(ctx, dl, f, header))
+	return true, nil
+}
+
+// fetchDownload fetches the complete file for uri from upstream and stores it
+// in the cache, independent of the client request that started the download.
+// If a checksum is known for uri, the file is only stored if it matches. The
+// fetch is aborted after downloadTimeout, releasing the download.
+func (pp *pkgProxy) fetchDownload(req *http.Request, rid string, repo string, uri string, dl *download) {
+	complete := false
+	defer func() {
+		pp.downloads.release(uri, dl, complete)
+	}()
+	ctx, cancel := context.WithTimeout(req.Context(), downloadTimeout)
+	defer cancel()
+	req = req.WithContext(ctx)
+
+	req.Method = http.MethodGet
+	req.Header = filterHeaders(req.Header, allowedRequestHeaders)
+	req.Header.Del("Range")
+	for _, name := range conditionalRequestHeaders {
+		req.Header.Del(name)
+	}
+
+	rsp, err := pp.tryMirrors(req.Context(), rid, req, repo, nil)
+	if rsp != nil {
+		defer rsp.Body.Close()
+	}
+	if err != nil || rsp == nil {
+		slog.Error("cache fetch failed", "request_id", rid, "uri", uri, "error", err)
+		return
+	}
+	if !isCacheable(rsp.Header) {
+		// concurrent requests fetch the file on their own
+		slog.Info("cache fetch skipped", "request_id", rid, "uri", uri, "error", errNotCacheable)
+		return
+	}
+	dl.setHeader(rsp.StatusCode, rsp.Header)
+	if rsp.StatusCode != http.StatusOK {
+		return
+	}
+	checksum, _ := pp.checksums.Lookup(uri)
+	if err := storeResponse(pp.upstreams[repo].cache, rid, uri, rsp, dl, checksum); err != nil {
+		slog.Error("cache fetch failed", "request_id", rid, "uri", uri, "error", err)
+		pp.metrics.cacheCommitFailures.WithLabelValues(repo).Inc()
+		return
+	}
+	pp.metrics.cacheCommits.WithLabelValues(repo).Inc()
+	complete = true
+}
+
 // Proxy request to upstream
 func (pp *pkgProxy) ForwardProxy(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c *echo.Context) error {
 		clientReq := c.Request()
-		clientRespW := c.Response()
 
 		if !pp.isRepositoryRequest(clientReq.RequestURI) {
 			return next(c)
@@ -295,16 +662,16 @@ func (pp *pkgProxy) ForwardProxy(next echo.HandlerFunc) echo.HandlerFunc {
 		}
 
 		repo := getRepoFromURI(clientReq.RequestURI)
-
-		// Derive an upstream context that is independent of client disconnects
-		// but preserves any existing request deadline, so upstream calls remain bounded.
-		upstreamCtx := context.Background()
-		if deadline, ok := clientReq.Context().Deadline(); ok {
-			var cancel context.CancelFunc
-			upstreamCtx, cancel = context.WithDeadline(context.Background(), deadline)
-			defer cancel()
+		if pp.upstreams[repo].offline {
+			return offlineMiss(c, repo, clientReq.RequestURI)
+		}
+		if pp.isNotFound(c, repo) {
+			return c.JSON(http.StatusNotFound, map[string]string{jsonKeyMessage: "Not Found"})
 		}
 
+		upstreamCtx, cancel := upstreamContext(clientReq)
+		defer cancel()
+
 		rsp, err := pp.tryMirrors(upstreamCtx, requestID(c), clientReq, repo, reqBody)
 		if rsp != nil {
 			defer rsp.Body.Close()
@@ -316,102 +683,196 @@ func (pp *pkgProxy) ForwardProxy(next echo.HandlerFunc) echo.HandlerFunc {
 			return echo.NewHTTPError(http.StatusBadGateway, "no mirror returned a response")
 		}
 
-		// copy response to client
-		for name, value := range filterHeaders(rsp.Header, allowedResponseHeaders) {
-			clientRespW.Header()[name] = value
-		}
-		clientRespW.WriteHeader(rsp.StatusCode)
-		_, _ = io.Copy(clientRespW, rsp.Body)
-
+		// tell a child pkgproxy whether it may cache the response
+		cacheable := pp.upstreams[repo].cache.IsCacheCandidate(clientReq.RequestURI) && isCacheable(rsp.Header)
+		c.Response().Header().Set(headerCacheable, strconv.FormatBool(cacheable))
+		defer pp.metrics.countServed(c, repo, sourceUpstream, responseSize(c))
+		copyResponse(c.Response(), rsp)
 		return nil
 	}
 }
 
-// tryMirrors iterates the mirrors for repo in order, following one redirect per mirror,
-// and returns the first 200 response. Each mirror is attempted up to the configured
+// offlineMiss responds to a request that can't be served from the cache of an
+// offline repository.
+func offlineMiss(c *echo.Context, repo string, uri string) error {
+	slog.Warn("offline cache miss", "request_id", requestID(c), "repository", repo, "uri", uri)
+	return c.JSON(http.StatusGatewayTimeout, map[string]string{
+		jsonKeyMessage: "Not cached and repository is offline",
+		"repository":   repo,
+		"uri":          uri,
+	})
+}
+
+// upstreamContext derives an upstream context that is independent of client
+// disconnects but preserves any existing request deadline, so upstream calls
+// remain bounded.
+func upstreamContext(req *http.Request) (context.Context, context.CancelFunc) {
+	if deadline, ok := req.Context().Deadline(); ok {
+		return context.WithDeadline(context.Background(), deadline)
+	}
+	return context.Background(), func() {}
+}
+
+// copyResponse writes the upstream response including the allowed headers
+// to the client.
+func copyResponse(w http.ResponseWriter, rsp *http.Response) {
+	for name, value := range filterHeaders(rsp.Header, allowedResponseHeaders) {
+		w.Header()[name] = value
+	}
+	w.WriteHeader(rsp.StatusCode)
+	_, _ = io.Copy(w, rsp.Body)
+}
+
+// tryMirrors iterates the healthy mirrors for repo, following one redirect per mirror,
+// and returns the first 200 response (or 304 response to a conditional request). Each mirror is attempted up to the configured
 // number of retries (useful when a redirector like download.fedoraproject.org sends
 // traffic to a broken mirror — retrying may yield a different, working mirror).
 // If no mirror returns 200, the last non-nil response (possibly non-200) is returned
-// with a nil error. A non-nil error is only returned when the last mirror attempt
+// with a nil error. If every mirror tried returned 404, the URI is added to the
+// negative cache. A non-nil error is only returned when the last mirror attempt
 // failed at the connection level (e.g. DNS failure, refused connection) — not when
-// the server replied with a non-200 HTTP status.
+// the server replied with a non-200 HTTP status — or errAllCircuitsOpen if no
+// mirror was tried at all.
 func (pp *pkgProxy) tryMirrors(ctx context.Context, rid string, req *http.Request, repo string, reqBody []byte) (*http.Response, error) {
 	var rsp *http.Response
 	var err error
+	tried, notFound := 0, 0
 
-	retries := pp.upstreams[repo].retries
+	for i, mirror := range pp.mirrors(rid, repo) {
+		// Close response from previous mirror before trying the next one.
+		if rsp != nil {
+			_ = rsp.Body.Close()
+		}
+		rsp, err = pp.tryMirror(ctx, rid, req, repo, i, mirror, reqBody)
+		if err != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if rsp != nil && (rsp.StatusCode == http.StatusOK || rsp.StatusCode == http.StatusNotModified) {
+			return rsp, nil
+		}
+		tried++
+		if rsp != nil && rsp.StatusCode == http.StatusNotFound {
+			notFound++
+		}
+	}
 
-	for i, mirror := range pp.upstreams[repo].mirrors {
-		for attempt := 1; attempt <= retries; attempt++ {
-			// Close response from previous failed attempt before retrying.
+	if ttl := pp.upstreams[repo].negativeTTL; ttl > 0 && tried > 0 && notFound == tried {
+		slog.Info("negative cache add", "request_id", rid, "uri", req.URL.RequestURI(), "ttl", ttl)
+		pp.notFound.add(req.URL.RequestURI(), ttl)
+	}
+	if tried == 0 && (pp.upstreams[repo].parent != nil || len(pp.mirrorList(repo)) > 0) {
+		return nil, errAllCircuitsOpen
+	}
+	return rsp, err
+}
+
+// isNotFound reports whether all mirrors recently returned 404 for the
+// requested URI.
+func (pp *pkgProxy) isNotFound(c *echo.Context, repo string) bool {
+	if pp.upstreams[repo].negativeTTL <= 0 || !pp.notFound.contains(c.Request().URL.RequestURI()) {
+		return false
+	}
+	slog.Debug("negative cache hit", "request_id", requestID(c), "uri", c.Request().URL.RequestURI())
+	pp.metrics.negativeCacheHits.WithLabelValues(repo).Inc()
+	return true
+}
+
+// tryMirror sends the request to mirror, which has index i in the mirror list
+// of repo, following one redirect per attempt and retrying on 5xx responses.
+// It returns the response of the last attempt, or an error if it failed at
+// the connection level. The outcome is recorded in the health of the mirror.
+func (pp *pkgProxy) tryMirror(ctx context.Context, rid string, req *http.Request, repo string, i int, mirror *url.URL, reqBody []byte) (rsp *http.Response, err error) {
+	retries := pp.upstreams[repo].retries
+	health := pp.upstreams[repo].health.get(mirror)
+	defer func() {
+		health.record(rsp, err, ctx.Err() != nil)
+	}()
+	if i == parentIndex {
+		req = pp.parentRequest(req, repo)
+		defer func() {
 			if rsp != nil {
-				_ = rsp.Body.Close()
-				rsp = nil
+				parentResponse(rsp)
 			}
+		}()
+	}
 
-			if attempt > 1 {
-				delay := pp.retryBaseDelay * (1 << (attempt - 2))
-				slog.Info("retrying mirror", "request_id", rid, "mirror_index", i, "attempt", attempt, "delay", delay)
-				timer := time.NewTimer(delay)
-				select {
-				case <-timer.C:
-				case <-ctx.Done():
-					timer.Stop()
-					return nil, ctx.Err()
-				}
+	for attempt := 1; attempt <= retries; attempt++ {
+		// Close response from previous failed attempt before retrying.
+		if rsp != nil {
+			_ = rsp.Body.Close()
+			rsp = nil
+		}
+
+		if attempt > 1 {
+			pp.metrics.upstreamRetries.WithLabelValues(repo, mirror.Host).Inc()
+			delay := pp.retryBaseDelay * (1 << (attempt - 2))
+			slog.Info("retrying mirror", "request_id", rid, "mirror_index", i, "attempt", attempt, "delay", delay)
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
 			}
+		}
 
-			upstreamPath := path.Join(mirror.Path, strings.TrimPrefix(req.URL.Path, "/"+repo))
-			rsp, err = pp.forwardClientRequestToOrigin(ctx, rid, req, &url.URL{
-				Scheme:   mirror.Scheme,
-				Host:     mirror.Host,
-				Path:     upstreamPath,
-				RawQuery: req.URL.RawQuery,
-			}, reqBody)
+		upstreamPath := path.Join(mirror.Path, strings.TrimPrefix(req.URL.Path, "/"+repo))
+		start := time.Now()
+		rsp, err = pp.forwardClientRequestToOrigin(ctx, rid, req, repo, &url.URL{
+			Scheme:   mirror.Scheme,
+			Host:     mirror.Host,
+			Path:     upstreamPath,
+			RawQuery: req.URL.RawQuery,
+		}, reqBody)
+		pp.metrics.observeUpstream(repo, mirror.Host, start, rsp, err)
+		if err != nil {
+			slog.Warn("upstream request failed", "request_id", rid, "mirror_index", i, "attempt", attempt, "error", err)
+			return nil, err // connection-level error, skip to next mirror
+		}
+		health.observeLatency(time.Since(start))
+		slog.Info("upstream response", "request_id", rid, "status", rsp.Status, "headers", rsp.Header)
+
+		// Follow HTTP redirects.
+		if utils.Contains(redirectStatusCodes, rsp.StatusCode) {
+			location, locErr := rsp.Location()
+			_ = rsp.Body.Close()
+			if locErr != nil {
+				slog.Warn("upstream request failed", "request_id", rid, "mirror_index", i, "attempt", attempt, "error", locErr)
+				return nil, locErr // bad redirect, skip to next mirror
+			}
+			start = time.Now()
+			rsp, err = pp.forwardClientRequestToOrigin(ctx, rid, req, repo, location, reqBody)
+			pp.metrics.observeUpstream(repo, mirror.Host, start, rsp, err)
 			if err != nil {
 				slog.Warn("upstream request failed", "request_id", rid, "mirror_index", i, "attempt", attempt, "error", err)
-				break // connection-level error, skip to next mirror
+				return nil, err // connection-level error, skip to next mirror
 			}
 			slog.Info("upstream response", "request_id", rid, "status", rsp.Status, "headers", rsp.Header)
+		}
 
-			// Follow HTTP redirects.
-			if utils.Contains(redirectStatusCodes, rsp.StatusCode) {
-				location, locErr := rsp.Location()
-				_ = rsp.Body.Close()
-				rsp = nil
-				if locErr != nil {
-					err = locErr
-					slog.Warn("upstream request failed", "request_id", rid, "mirror_index", i, "attempt", attempt, "error", err)
-					break // bad redirect, skip to next mirror
-				}
-				rsp, err = pp.forwardClientRequestToOrigin(ctx, rid, req, location, reqBody)
-				if err != nil {
-					slog.Warn("upstream request failed", "request_id", rid, "mirror_index", i, "attempt", attempt, "error", err)
-					break // connection-level error, skip to next mirror
-				}
-				slog.Info("upstream response", "request_id", rid, "status", rsp.Status, "headers", rsp.Header)
-			}
-
-			if rsp.StatusCode == http.StatusOK {
-				return rsp, nil
-			}
-
-			// Retry this mirror if we got a server error (5xx) and have attempts left.
-			if rsp.StatusCode >= 500 && attempt < retries {
-				slog.Warn("upstream server error, will retry", "request_id", rid, "mirror_index", i, "attempt", attempt, "status", rsp.StatusCode)
-				continue
-			}
-
-			// Non-5xx non-200 (e.g. 404): no point retrying this mirror.
-			break
+		// Retry this mirror if we got a server error (5xx) and have attempts left.
+		if rsp.StatusCode >= 500 && attempt < retries {
+			slog.Warn("upstream server error, will retry", "request_id", rid, "mirror_index", i, "attempt", attempt, "status", rsp.StatusCode)
+			continue
 		}
+
+		// Success, or non-5xx non-200 (e.g. 404): no point retrying this mirror.
+		break
 	}
 
 	return rsp, err
 }
 
-func (pp *pkgProxy) forwardClientRequestToOrigin(ctx context.Context, rid string, req *http.Request, origin *url.URL, bodyBytes []byte) (*http.Response, error) {
+func (pp *pkgProxy) forwardClientRequestToOrigin(ctx context.Context, rid string, req *http.Request, repo string, origin *url.URL, bodyBytes []byte) (*http.Response, error) {
 	headers := filterHeaders(req.Header, allowedRequestHeaders)
+	transport := pp.upstreams[repo].transport
+	// the credentials must never leak to other hosts, e.g. through a redirect
+	if auth := pp.upstreams[repo].auth; auth.matches(origin) {
+		auth.apply(headers)
+		if auth.transport != nil {
+			transport = auth.transport
+		}
+	}
 
 	slog.InfoContext(ctx, "upstream request", "request_id", rid, "method", req.Method, "origin", origin)
 	// Construct request to send to origin server
@@ -423,7 +884,7 @@ func (pp *pkgProxy) forwardClientRequestToOrigin(ctx context.Context, rid string
 		Method:        req.Method,
 		URL:           origin,
 	}).WithContext(ctx)
-	return pp.transport.RoundTrip(upstreamReq)
+	return transport.RoundTrip(upstreamReq)
 }
 
 // filterHeaders returns a new http.Header containing only the allowed header keys from src.
@@ -448,7 +909,15 @@ func (pp *pkgProxy) isRepositoryRequest(uri string) bool {
 	return utils.Contains(utils.KeysFromMap(pp.upstreams), repo)
 }
 
-// Return the repository name of the URL without leading "/"
+// Return the repository name of the URL without leading "/" and snapshot
+// suffix
 func getRepoFromURI(uri string) string {
-	return strings.TrimPrefix(utils.RouteFromURI(uri), "/")
+	repo, _, _ := getSnapshotFromURI(uri)
+	return repo
+}
+
+// Return the repository name and the snapshot name of the URL and whether
+// the URL addresses a snapshot (e.g. "/fedora@2026-10-01/...").
+func getSnapshotFromURI(uri string) (string, string, bool) {
+	return strings.Cut(strings.TrimPrefix(utils.RouteFromURI(uri), "/"), "@")
 }
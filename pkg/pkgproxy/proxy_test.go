@@ -3,60 +3,66 @@
 package pkgproxy
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/ganto/pkgproxy/pkg/cache"
 	echo "github.com/labstack/echo/v5"
 	"github.com/labstack/echo/v5/middleware"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-// newTestProxy creates a pkgProxy with a single "testrepo" repository using the given mirrors.
-// Returns the proxy and the temporary cache directory path.
-func newTestProxy(t *testing.T, mirrors []string) (PkgProxy, string) {
+// newTestProxyWithRepo creates a pkgProxy with repo as the single "testrepo"
+// repository. The cache suffixes default to ".rpm" and configure may adjust the
+// proxy configuration. Returns the proxy and the temporary cache directory path.
+func newTestProxyWithRepo(t *testing.T, repo Repository, configure ...func(*PkgProxyConfig)) (*pkgProxy, string) {
 	t.Helper()
-	cacheDir := t.TempDir()
+	if repo.CacheSuffixes == nil {
+		repo.CacheSuffixes = []string{".rpm"}
+	}
 	repoConfig := &RepoConfig{
-		Repositories: map[string]Repository{
-			"testrepo": {
-				CacheSuffixes: []string{".rpm"},
-				Mirrors:       mirrors,
-			},
-		},
+		Repositories: map[string]Repository{"testrepo": repo},
 	}
-	pp := New(&PkgProxyConfig{
+	require.NoError(t, validateConfig(repoConfig))
+	cacheDir := t.TempDir()
+	config := &PkgProxyConfig{
+		AdminToken:       testAdminToken,
 		CacheBasePath:    cacheDir,
 		RepositoryConfig: repoConfig,
-	})
-	return pp, cacheDir
+	}
+	for _, f := range configure {
+		f(config)
+	}
+	return New(config).(*pkgProxy), cacheDir
+}
+
+// newTestProxy creates a pkgProxy with a single "testrepo" repository using the given mirrors.
+// Returns the proxy and the temporary cache directory path.
+func newTestProxy(t *testing.T, mirrors []string) (PkgProxy, string) {
+	t.Helper()
+	return newTestProxyWithRepo(t, Repository{Mirrors: mirrors})
 }
 
 // newTestProxyWithRetries creates a pkgProxy with a single "testrepo" repository using the given mirrors and retries.
 // The retry delay is set to zero for fast tests.
 func newTestProxyWithRetries(t *testing.T, mirrors []string, retries int) (PkgProxy, string) {
 	t.Helper()
-	cacheDir := t.TempDir()
-	repoConfig := &RepoConfig{
-		Repositories: map[string]Repository{
-			"testrepo": {
-				CacheSuffixes: []string{".rpm"},
-				Mirrors:       mirrors,
-				Retries:       retries,
-			},
-		},
-	}
-	pp := New(&PkgProxyConfig{
-		CacheBasePath:    cacheDir,
-		RepositoryConfig: repoConfig,
-	})
-	pp.(*pkgProxy).retryBaseDelay = 0
+	pp, cacheDir := newTestProxyWithRepo(t, Repository{Mirrors: mirrors, Retries: retries})
+	pp.retryBaseDelay = 0
 	return pp, cacheDir
 }
 
@@ -89,6 +95,7 @@ func TestGetRepoFromURI(t *testing.T) {
 		{"/testrepo/some/path/file.rpm", "testrepo"},
 		{"/testrepo/", "testrepo"},
 		{"/testrepo", "testrepo"},
+		{"/testrepo@2026-10-01/some/path/file.rpm", "testrepo"},
 		{"/", ""},
 		{"", ""},
 	}
@@ -260,9 +267,7 @@ func TestCacheDeleteExisting(t *testing.T) {
 
 	app := newTestApp(pp)
 
-	req := httptest.NewRequest(http.MethodDelete, "/testrepo/some/package.rpm", nil)
-	rec := httptest.NewRecorder()
-	app.ServeHTTP(rec, req)
+	rec := adminRequest(app, http.MethodDelete, "/testrepo/some/package.rpm", "")
 
 	assert.Equal(t, http.StatusOK, rec.Code)
 
@@ -279,9 +284,7 @@ func TestCacheDeleteNonExistent(t *testing.T) {
 	pp, _ := newTestProxy(t, []string{"http://example.com/"})
 	app := newTestApp(pp)
 
-	req := httptest.NewRequest(http.MethodDelete, "/testrepo/some/package.rpm", nil)
-	rec := httptest.NewRecorder()
-	app.ServeHTTP(rec, req)
+	rec := adminRequest(app, http.MethodDelete, "/testrepo/some/package.rpm", "")
 
 	assert.Equal(t, http.StatusNotFound, rec.Code)
 }
@@ -961,3 +964,711 @@ func TestForwardProxyDefaultRetriesIsOne(t *testing.T) {
 	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
 	assert.Equal(t, 1, requestCount, "expected only 1 attempt with default retries")
 }
+
+// --- Cache quota tests ---
+
+func TestCacheMaxSizeEvictsLeastRecentlyUsed(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "0123456789")
+	}))
+	defer upstream.Close()
+
+	cacheDir := t.TempDir()
+	pp := New(&PkgProxyConfig{
+		CacheBasePath: cacheDir,
+		RepositoryConfig: &RepoConfig{
+			Repositories: map[string]Repository{
+				"testrepo": {
+					CacheSuffixes: []string{".rpm"},
+					Mirrors:       []string{upstream.URL + "/"},
+					MaxSize:       25,
+				},
+			},
+		},
+	})
+	app := newTestApp(pp)
+
+	get := func(uri string) {
+		req := httptest.NewRequest(http.MethodGet, uri, nil)
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	get("/testrepo/a.rpm")
+	get("/testrepo/b.rpm")
+	// cache hit on a.rpm makes b.rpm the least recently used file
+	get("/testrepo/a.rpm")
+	get("/testrepo/c.rpm")
+
+	assert.FileExists(t, filepath.Join(cacheDir, "testrepo", "a.rpm"))
+	assert.NoFileExists(t, filepath.Join(cacheDir, "testrepo", "b.rpm"))
+	assert.FileExists(t, filepath.Join(cacheDir, "testrepo", "c.rpm"))
+}
+
+// --- Metadata revalidation tests ---
+
+func TestCacheMetadataServedWhileFresh(t *testing.T) {
+	requestCount := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		w.Header().Set("Etag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 01 Jan 2024 00:00:00 GMT")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "<repomd v1/>")
+	}))
+	defer upstream.Close()
+
+	pp, cacheDir := newTestProxyWithRepo(t, Repository{
+		Metadata: &MetadataConfig{Patterns: []string{"repomd.xml"}, MaxAge: time.Hour},
+		Mirrors:  []string{upstream.URL + "/"},
+	})
+	app := newTestApp(pp)
+
+	for range 2 {
+		req := httptest.NewRequest(http.MethodGet, "/testrepo/repodata/repomd.xml", nil)
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "<repomd v1/>", rec.Body.String())
+		assert.Equal(t, `"v1"`, rec.Header().Get("Etag"))
+	}
+	assert.Equal(t, 1, requestCount, "expected fresh metadata to be served from cache")
+	assert.FileExists(t, filepath.Join(cacheDir, "testrepo", "repodata", "repomd.xml"))
+}
+
+func TestCacheMetadataRevalidateNotModified(t *testing.T) {
+	var conditional http.Header
+	requestCount := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional = r.Header.Clone()
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Etag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 01 Jan 2024 00:00:00 GMT")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "<repomd v1/>")
+	}))
+	defer upstream.Close()
+
+	pp, _ := newTestProxyWithRepo(t, Repository{
+		Metadata: &MetadataConfig{Patterns: []string{"repomd.xml"}, MaxAge: time.Nanosecond},
+		Mirrors:  []string{upstream.URL + "/"},
+	})
+	app := newTestApp(pp)
+
+	for range 2 {
+		req := httptest.NewRequest(http.MethodGet, "/testrepo/repodata/repomd.xml", nil)
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "<repomd v1/>", rec.Body.String())
+	}
+	assert.Equal(t, 2, requestCount)
+	require.NotNil(t, conditional, "expected a conditional revalidation request")
+	assert.Equal(t, "Mon, 01 Jan 2024 00:00:00 GMT", conditional.Get("If-Modified-Since"))
+}
+
+func TestCacheMetadataRevalidateRefreshes(t *testing.T) {
+	version := "v1"
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Etag", `"`+version+`"`)
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "<repomd %s/>", version)
+	}))
+	defer upstream.Close()
+
+	pp, cacheDir := newTestProxyWithRepo(t, Repository{
+		Metadata: &MetadataConfig{Patterns: []string{"repomd.xml"}, MaxAge: time.Nanosecond},
+		Mirrors:  []string{upstream.URL + "/"},
+	})
+	app := newTestApp(pp)
+
+	req := httptest.NewRequest(http.MethodGet, "/testrepo/repodata/repomd.xml", nil)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	assert.Equal(t, "<repomd v1/>", rec.Body.String())
+
+	version = "v2"
+	req = httptest.NewRequest(http.MethodGet, "/testrepo/repodata/repomd.xml", nil)
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "<repomd v2/>", rec.Body.String())
+	assert.Equal(t, `"v2"`, rec.Header().Get("Etag"))
+
+	data, err := os.ReadFile(filepath.Join(cacheDir, "testrepo", "repodata", "repomd.xml"))
+	require.NoError(t, err)
+	assert.Equal(t, "<repomd v2/>", string(data))
+}
+
+func TestCacheMetadataRevalidateNotCacheable(t *testing.T) {
+	version := "v1"
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if version != "v1" {
+			w.Header().Set(headerCacheable, "false")
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "<repomd %s/>", version)
+	}))
+	defer upstream.Close()
+
+	pp, cacheDir := newTestProxyWithRepo(t, Repository{
+		Metadata: &MetadataConfig{Patterns: []string{"repomd.xml"}, MaxAge: time.Nanosecond},
+		Mirrors:  []string{upstream.URL + "/"},
+	})
+	app := newTestApp(pp)
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/testrepo/repodata/repomd.xml", nil))
+	assert.Equal(t, "<repomd v1/>", rec.Body.String())
+
+	// the fresh copy is passed on instead of the outdated cached one
+	version = "v2"
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/testrepo/repodata/repomd.xml", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "<repomd v2/>", rec.Body.String())
+	assert.Equal(t, "false", rec.Header().Get(headerCacheable))
+
+	data, err := os.ReadFile(filepath.Join(cacheDir, "testrepo", "repodata", "repomd.xml"))
+	require.NoError(t, err)
+	assert.Equal(t, "<repomd v1/>", string(data))
+}
+
+// newTestProxyWithStaleIfError creates a pkgProxy with a single "testrepo"
+// repository whose cached repomd.xml was validated 10 minutes ago.
+func newTestProxyWithStaleIfError(t *testing.T, mirrors []string, staleIfError time.Duration) (*pkgProxy, string) {
+	t.Helper()
+	pp, cacheDir := newTestProxyWithRepo(t, Repository{
+		Metadata: &MetadataConfig{
+			Patterns:     []string{"repomd.xml"},
+			MaxAge:       time.Minute,
+			StaleIfError: staleIfError,
+		},
+		Mirrors: mirrors,
+	})
+	// cached copy which was validated 10 minutes ago
+	writeCachedFile(t, cacheDir, "/testrepo/repodata/repomd.xml", "<repomd stale/>")
+	require.NoError(t, pp.upstreams["testrepo"].cache.SetMetadata("/testrepo/repodata/repomd.xml", &cache.Metadata{
+		ETag:      `"stale"`,
+		Validated: time.Now().Add(-10 * time.Minute),
+	}))
+	return pp, cacheDir
+}
+
+func TestCacheMetadataStaleIfError(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	unreachable := "http://" + l.Addr().String() + "/"
+	l.Close()
+
+	for name, mirror := range map[string]string{"5xx": upstream.URL + "/", "connection error": unreachable} {
+		t.Run(name, func(t *testing.T) {
+			pp, _ := newTestProxyWithStaleIfError(t, []string{mirror}, time.Hour)
+			app := newTestApp(pp)
+
+			req := httptest.NewRequest(http.MethodGet, "/testrepo/repodata/repomd.xml", nil)
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, "<repomd stale/>", rec.Body.String())
+			assert.Equal(t, `111 - "Revalidation Failed"`, rec.Header().Get("Warning"))
+			assert.Equal(t, `"stale"`, rec.Header().Get("Etag"))
+			age, err := strconv.Atoi(rec.Header().Get("Age"))
+			require.NoError(t, err)
+			assert.GreaterOrEqual(t, age, 600)
+		})
+	}
+}
+
+func TestCacheMetadataStaleIfErrorWithoutSidecar(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	pp, cacheDir := newTestProxyWithStaleIfError(t, []string{upstream.URL + "/"}, time.Hour)
+	cached := filepath.Join(cacheDir, "testrepo", "repodata", "repomd.xml")
+	require.NoError(t, os.Remove(cached+".pkgproxy.json"))
+	mtime := time.Now().Add(-10 * time.Minute)
+	require.NoError(t, os.Chtimes(cached, mtime, mtime))
+	app := newTestApp(pp)
+
+	// the modification time of the cached file stands in for the validation time
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/testrepo/repodata/repomd.xml", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "<repomd stale/>", rec.Body.String())
+	assert.Equal(t, `111 - "Revalidation Failed"`, rec.Header().Get("Warning"))
+	age, err := strconv.Atoi(rec.Header().Get("Age"))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, age, 600)
+}
+
+func TestCacheMetadataStaleIfErrorExpired(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	// validated 10 minutes ago, max_age + stale_if_error is 6 minutes
+	pp, _ := newTestProxyWithStaleIfError(t, []string{upstream.URL + "/"}, 5*time.Minute)
+	app := newTestApp(pp)
+
+	req := httptest.NewRequest(http.MethodGet, "/testrepo/repodata/repomd.xml", nil)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Empty(t, rec.Header().Get("Warning"))
+}
+
+func TestCacheConcurrentMissesCoalesced(t *testing.T) {
+	var requestCount atomic.Int32
+	started := make(chan struct{})
+	proceed := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requestCount.Add(1) == 1 {
+			close(started)
+		}
+		w.Header().Set("Content-Length", "20")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "first-half|")
+		w.(http.Flusher).Flush()
+		<-proceed
+		fmt.Fprint(w, "remaining")
+	}))
+	defer upstream.Close()
+
+	pp, cacheDir := newTestProxy(t, []string{upstream.URL + "/"})
+	app := newTestApp(pp)
+
+	var wg sync.WaitGroup
+	recs := make([]*httptest.ResponseRecorder, 4)
+	for i := range recs {
+		recs[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodGet, "/testrepo/path/file.rpm", nil)
+			app.ServeHTTP(recs[i], req)
+		}()
+		if i == 0 {
+			<-started
+		}
+	}
+	// give the followers time to attach to the in-progress download
+	time.Sleep(50 * time.Millisecond)
+	close(proceed)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), requestCount.Load(), "expected a single upstream request")
+	for _, rec := range recs {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "first-half|remaining", rec.Body.String())
+	}
+	assert.FileExists(t, filepath.Join(cacheDir, "testrepo", "path", "file.rpm"))
+}
+
+func TestCacheConcurrentMissFollowerFallback(t *testing.T) {
+	var requestCount atomic.Int32
+	started := make(chan struct{})
+	proceed := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requestCount.Add(1) == 1 {
+			close(started)
+			<-proceed
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer upstream.Close()
+
+	pp, _ := newTestProxyWithRetries(t, []string{upstream.URL + "/"}, 0)
+	app := newTestApp(pp)
+
+	leader := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		app.ServeHTTP(leader, httptest.NewRequest(http.MethodGet, "/testrepo/path/file.rpm", nil))
+	}()
+	<-started
+
+	follower := httptest.NewRecorder()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(proceed)
+	}()
+	app.ServeHTTP(follower, httptest.NewRequest(http.MethodGet, "/testrepo/path/file.rpm", nil))
+	<-done
+
+	assert.Equal(t, http.StatusServiceUnavailable, leader.Code)
+	// the follower fetched the file on its own after the leader failed
+	assert.Equal(t, http.StatusNotFound, follower.Code)
+	assert.Equal(t, int32(2), requestCount.Load())
+}
+
+func TestCacheRangeMissFetchesFullFile(t *testing.T) {
+	var requestCount atomic.Int32
+	var rangeHeader atomic.Value
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount.Add(1)
+		rangeHeader.Store(r.Header.Get("Range"))
+		w.Header().Set("Content-Length", "10")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "0123456789")
+	}))
+	defer upstream.Close()
+
+	pp, cacheDir := newTestProxy(t, []string{upstream.URL + "/"})
+	app := newTestApp(pp)
+
+	req := httptest.NewRequest(http.MethodGet, "/testrepo/path/file.rpm", nil)
+	req.Header.Set("Range", "bytes=5-")
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, "56789", rec.Body.String())
+	assert.Equal(t, "bytes 5-9/10", rec.Header().Get("Content-Range"))
+	assert.Empty(t, rangeHeader.Load(), "expected the full file to be requested upstream")
+
+	// the background fetch commits the file shortly after the response
+	cachedFile := filepath.Join(cacheDir, "testrepo", "path", "file.rpm")
+	assert.Eventually(t, func() bool {
+		content, err := os.ReadFile(cachedFile)
+		return err == nil && string(content) == "0123456789"
+	}, time.Second, 10*time.Millisecond)
+
+	req = httptest.NewRequest(http.MethodGet, "/testrepo/path/file.rpm", nil)
+	req.Header.Set("Range", "bytes=0-1")
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, "01", rec.Body.String())
+	assert.Equal(t, int32(1), requestCount.Load())
+}
+
+func TestCacheMultiRangeFromCache(t *testing.T) {
+	pp, cacheDir := newTestProxy(t, []string{"http://localhost:1/"})
+	app := newTestApp(pp)
+
+	cachedFile := filepath.Join(cacheDir, "testrepo", "path", "file.rpm")
+	require.NoError(t, os.MkdirAll(filepath.Dir(cachedFile), 0o750))
+	require.NoError(t, os.WriteFile(cachedFile, []byte("0123456789"), 0o600))
+
+	req := httptest.NewRequest(http.MethodGet, "/testrepo/path/file.rpm", nil)
+	req.Header.Set("Range", "bytes=0-1,8-9")
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "multipart/byteranges")
+	assert.Contains(t, rec.Body.String(), "01")
+	assert.Contains(t, rec.Body.String(), "89")
+}
+
+func TestCacheRangeFromInProgressDownload(t *testing.T) {
+	var requestCount atomic.Int32
+	started := make(chan struct{})
+	proceed := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount.Add(1)
+		w.Header().Set("Content-Length", "10")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "01234")
+		w.(http.Flusher).Flush()
+		close(started)
+		<-proceed
+		fmt.Fprint(w, "56789")
+	}))
+	defer upstream.Close()
+
+	pp, _ := newTestProxy(t, []string{upstream.URL + "/"})
+	app := newTestApp(pp)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/testrepo/path/file.rpm", nil))
+	}()
+	<-started
+
+	// the first range is already written, the second one is still in transit
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(proceed)
+	}()
+	req := httptest.NewRequest(http.MethodGet, "/testrepo/path/file.rpm", nil)
+	req.Header.Set("Range", "bytes=1-2,7-8")
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	<-done
+
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Contains(t, rec.Body.String(), "12")
+	assert.Contains(t, rec.Body.String(), "78")
+	assert.Equal(t, int32(1), requestCount.Load())
+}
+
+// withChecksum adds the SHA-256 checksum of content for /testrepo/<location>
+// to the checksum store.
+func withChecksum(pp PkgProxy, location string, content string) {
+	sum := sha256.Sum256([]byte(content))
+	pp.(*pkgProxy).checksums.Update("/testrepo/repodata/primary.xml.gz", "/testrepo", map[string]string{
+		location: hex.EncodeToString(sum[:]),
+	})
+}
+
+func TestCacheChecksumMismatchTriesNextMirror(t *testing.T) {
+	mirror1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "tampered-body")
+	}))
+	defer mirror1.Close()
+	mirror2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "package-body")
+	}))
+	defer mirror2.Close()
+
+	pp, cacheDir := newTestProxy(t, []string{mirror1.URL + "/", mirror2.URL + "/"})
+	withChecksum(pp, "Packages/file.rpm", "package-body")
+	server := httptest.NewServer(newTestApp(pp))
+	defer server.Close()
+
+	// the client receives nothing of the tampered file
+	rsp, err := http.Get(server.URL + "/testrepo/Packages/file.rpm")
+	require.NoError(t, err)
+	body, err := io.ReadAll(rsp.Body)
+	_ = rsp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rsp.StatusCode)
+	assert.Equal(t, "package-body", string(body))
+
+	content, err := os.ReadFile(filepath.Join(cacheDir, "testrepo", "Packages", "file.rpm"))
+	require.NoError(t, err)
+	assert.Equal(t, "package-body", string(content))
+	up := pp.(*pkgProxy).upstreams["testrepo"]
+	assert.Equal(t, 1, up.health.get(up.mirrors[0]).status("").ConsecutiveFailures)
+}
+
+func TestCacheChecksumMismatchAllMirrors(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "tampered-body")
+	}))
+	defer upstream.Close()
+
+	pp, cacheDir := newTestProxy(t, []string{upstream.URL + "/"})
+	withChecksum(pp, "Packages/file.rpm", "package-body")
+	app := newTestApp(pp)
+
+	req := httptest.NewRequest(http.MethodGet, "/testrepo/Packages/file.rpm", nil)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "tampered")
+	assert.NoFileExists(t, filepath.Join(cacheDir, "testrepo", "Packages", "file.rpm"))
+	entries, err := os.ReadDir(filepath.Join(cacheDir, "testrepo", "Packages"))
+	require.NoError(t, err)
+	assert.Empty(t, entries, "expected rejected temp files to be removed")
+}
+
+func TestCacheChecksumFollowerWaitsForVerification(t *testing.T) {
+	var requests atomic.Int32
+	started := make(chan struct{})
+	proceed := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) > 1 {
+			fmt.Fprint(w, "tampered-body")
+			return
+		}
+		w.Header().Set("Content-Length", "13")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "tampered-")
+		w.(http.Flusher).Flush()
+		close(started)
+		<-proceed
+		fmt.Fprint(w, "body")
+	}))
+	defer upstream.Close()
+
+	pp, cacheDir := newTestProxyWithRepo(t, Repository{
+		Mirrors:      []string{upstream.URL + "/"},
+		MirrorHealth: &MirrorHealthConfig{FailureThreshold: 2},
+	})
+	withChecksum(pp, "Packages/file.rpm", "package-body")
+	server := httptest.NewServer(newTestApp(pp))
+	defer server.Close()
+
+	leader := make(chan struct{})
+	go func() {
+		defer close(leader)
+		if rsp, err := http.Get(server.URL + "/testrepo/Packages/file.rpm"); err == nil {
+			_, _ = io.Copy(io.Discard, rsp.Body)
+			_ = rsp.Body.Close()
+		}
+	}()
+	<-started
+
+	// the follower neither reads the unverified temp file nor the unverified
+	// response of its own request once the leader failed
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(proceed)
+	}()
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/testrepo/Packages/file.rpm", nil)
+	require.NoError(t, err)
+	req.Header.Set("Range", "bytes=0-6")
+	rsp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(rsp.Body)
+	_ = rsp.Body.Close()
+	require.NoError(t, err)
+	<-leader
+
+	assert.Equal(t, http.StatusBadGateway, rsp.StatusCode)
+	assert.NotContains(t, string(body), "tampered")
+	assert.Equal(t, int32(2), requests.Load())
+	assert.NoFileExists(t, filepath.Join(cacheDir, "testrepo", "Packages", "file.rpm"))
+}
+
+func TestCacheIndexesRepositoryMetadata(t *testing.T) {
+	sum := sha256.Sum256([]byte("package-body"))
+	primary := `<metadata><package><checksum type="sha256">` + hex.EncodeToString(sum[:]) +
+		`</checksum><location href="Packages/file.rpm"/></package></metadata>`
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, primary)
+	}))
+	defer upstream.Close()
+
+	cacheDir := t.TempDir()
+	pp := New(&PkgProxyConfig{
+		CacheBasePath: cacheDir,
+		RepositoryConfig: &RepoConfig{
+			Repositories: map[string]Repository{
+				"testrepo": {
+					CacheSuffixes: []string{".rpm"},
+					Metadata:      &MetadataConfig{Patterns: []string{"*primary.xml*"}},
+					Mirrors:       []string{upstream.URL + "/"},
+				},
+			},
+		},
+	})
+	app := newTestApp(pp)
+
+	req := httptest.NewRequest(http.MethodGet, "/testrepo/repodata/abcd-primary.xml", nil)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	assert.Eventually(t, func() bool {
+		checksum, ok := pp.(*pkgProxy).checksums.Lookup("/testrepo/Packages/file.rpm")
+		return ok && checksum == hex.EncodeToString(sum[:])
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestOfflineServesFromCacheOnly(t *testing.T) {
+	var requests atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fmt.Fprint(w, "upstream")
+	}))
+	defer upstream.Close()
+
+	cacheDir := t.TempDir()
+	pp := New(&PkgProxyConfig{
+		CacheBasePath: cacheDir,
+		RepositoryConfig: &RepoConfig{
+			Repositories: map[string]Repository{
+				"testrepo": {
+					CacheSuffixes: []string{".rpm"},
+					Metadata:      &MetadataConfig{Patterns: []string{"repomd.xml"}, MaxAge: time.Nanosecond},
+					Mirrors:       []string{upstream.URL + "/"},
+				},
+			},
+		},
+		Offline: true,
+	})
+	app := newTestApp(pp)
+	writeCachedFile(t, cacheDir, "/testrepo/Packages/cached.rpm", "cached")
+	writeCachedFile(t, cacheDir, "/testrepo/repodata/repomd.xml", "<repomd stale/>")
+
+	for _, tt := range []struct {
+		uri    string
+		status int
+		body   string
+	}{
+		{"/testrepo/Packages/cached.rpm", http.StatusOK, "cached"},
+		{"/testrepo/repodata/repomd.xml", http.StatusOK, "<repomd stale/>"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tt.uri, nil)
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		assert.Equal(t, tt.status, rec.Code, tt.uri)
+		assert.Equal(t, tt.body, rec.Body.String(), tt.uri)
+	}
+
+	// misses of cache candidates and other files are rejected
+	for _, uri := range []string{"/testrepo/Packages/missing.rpm", "/testrepo/other.txt"} {
+		req := httptest.NewRequest(http.MethodGet, uri, nil)
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusGatewayTimeout, rec.Code, uri)
+		var body map[string]string
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		assert.Equal(t, "testrepo", body["repository"])
+		assert.Equal(t, uri, body["uri"])
+	}
+	assert.Equal(t, int32(0), requests.Load(), "expected no upstream requests while offline")
+}
+
+func TestOfflinePerRepository(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "upstream")
+	}))
+	defer upstream.Close()
+
+	pp := New(&PkgProxyConfig{
+		CacheBasePath: t.TempDir(),
+		RepositoryConfig: &RepoConfig{
+			Repositories: map[string]Repository{
+				"offline": {
+					CacheSuffixes: []string{".rpm"},
+					Mirrors:       []string{upstream.URL + "/"},
+					Offline:       true,
+				},
+				"online": {
+					CacheSuffixes: []string{".rpm"},
+					Mirrors:       []string{upstream.URL + "/"},
+				},
+			},
+		},
+	})
+	app := newTestApp(pp)
+
+	req := httptest.NewRequest(http.MethodGet, "/offline/file.rpm", nil)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/online/file.rpm", nil)
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "upstream", rec.Body.String())
+}
@@ -0,0 +1,82 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package pkgproxy
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/ganto/pkgproxy/pkg/utils"
+	echo "github.com/labstack/echo/v5"
+)
+
+// RewriteProxyRequest must be registered with echo.Pre. It rewrites
+// absolute-form requests of clients using pkgproxy as HTTP proxy (e.g.
+// "GET http://deb.debian.org/debian/dists/...") to the URI of the
+// repository with a matching mirror, so that they are served by the same
+// Cache and ForwardProxy pipeline. Proxy requests not matching any mirror
+// are rejected to not act as an open proxy.
+func (pp *pkgProxy) RewriteProxyRequest(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c *echo.Context) error {
+		req := c.Request()
+		if req.Method == http.MethodConnect {
+			slog.Warn("proxy request rejected", "method", req.Method, "host", req.Host, "remote_ip", c.RealIP())
+			return c.JSON(http.StatusMethodNotAllowed, map[string]string{jsonKeyMessage: "Tunneling is not supported, use http:// repository URLs"})
+		}
+		if !req.URL.IsAbs() {
+			return next(c)
+		}
+		rewritten, ok := pp.matchProxyRequest(req.URL)
+		if !ok {
+			slog.Warn("proxy request rejected", "method", req.Method, "url", req.URL.Redacted(), "remote_ip", c.RealIP())
+			return c.JSON(http.StatusForbidden, map[string]string{jsonKeyMessage: "No repository configured for this URL"})
+		}
+		slog.Debug("proxy request", "url", req.URL.Redacted(), "uri", rewritten.RequestURI())
+		req.URL = rewritten
+		req.RequestURI = rewritten.RequestURI()
+		return next(c)
+	}
+}
+
+// matchProxyRequest returns the repository URL of the absolute URL u of a
+// proxy request. The host and port must match a configured mirror and the
+// path must be below the path of the mirror, the scheme is ignored. The
+// mirror with the longest path wins if several match.
+func (pp *pkgProxy) matchProxyRequest(u *url.URL) (*url.URL, bool) {
+	requestPath := path.Clean("/" + u.Path)
+	if strings.HasSuffix(u.Path, "/") && requestPath != "/" {
+		requestPath += "/"
+	}
+	var repo, rest string
+	matched := -1
+	for _, name := range utils.KeysFromMap(pp.upstreams) {
+		for _, mirror := range pp.upstreams[name].mirrors {
+			if mirrorHost(mirror) != mirrorHost(u) {
+				continue
+			}
+			prefix := strings.TrimSuffix(mirror.Path, "/") + "/"
+			if !strings.HasPrefix(requestPath, prefix) || len(prefix) <= matched {
+				continue
+			}
+			repo, rest, matched = name, strings.TrimPrefix(requestPath, prefix), len(prefix)
+		}
+	}
+	if matched < 0 {
+		return nil, false
+	}
+	return &url.URL{Path: "/" + repo + "/" + rest, RawQuery: u.RawQuery}, true
+}
+
+// mirrorHost returns the host of u without the default port of http and
+// https, so that an http request matches an https mirror on the same host.
+func mirrorHost(u *url.URL) string {
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		return net.JoinHostPort(host, port)
+	}
+	return host
+}
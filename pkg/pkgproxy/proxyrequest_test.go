@@ -0,0 +1,107 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package pkgproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewriteProxyRequest(t *testing.T) {
+	mirror, count := countingServer(t, "package", nil)
+	pp, cacheDir := newTestProxy(t, []string{mirror.URL + "/"})
+	app := newTestApp(pp)
+	app.Pre(pp.RewriteProxyRequest)
+
+	for range 2 {
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, mirror.URL+"/Packages/a.rpm", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "package", rec.Body.String())
+	}
+	assert.Equal(t, int32(1), count.Load(), "second request must be served from the cache")
+	assert.FileExists(t, filepath.Join(cacheDir, "testrepo", "Packages", "a.rpm"))
+
+	// origin-form requests are routed as before
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/testrepo/Packages/a.rpm", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, int32(1), count.Load())
+}
+
+func TestRewriteProxyRequestRejected(t *testing.T) {
+	mirror, count := countingServer(t, "package", nil)
+	pp, _ := newTestProxy(t, []string{mirror.URL + "/debian/"})
+	app := newTestApp(pp)
+	app.Pre(pp.RewriteProxyRequest)
+
+	for _, target := range []string{
+		"http://other.example.com/debian/a.rpm",
+		mirror.URL + "/ubuntu/a.rpm",
+		mirror.URL + "/debian/../ubuntu/a.rpm",
+		mirror.URL + "/debian-security/a.rpm",
+	} {
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusForbidden, rec.Code, target)
+	}
+
+	req := httptest.NewRequest(http.MethodConnect, "/", nil)
+	req.URL = &url.URL{Host: "deb.debian.org:443"}
+	req.RequestURI = "deb.debian.org:443"
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, int32(0), count.Load())
+}
+
+func TestMatchProxyRequest(t *testing.T) {
+	repoConfig := &RepoConfig{
+		Repositories: map[string]Repository{
+			"debian": {
+				CacheSuffixes: []string{".deb"},
+				Mirrors:       []string{"https://deb.debian.org/debian/"},
+			},
+			"debian-security": {
+				CacheSuffixes: []string{".deb"},
+				Mirrors:       []string{"http://deb.debian.org/debian-security"},
+			},
+			"centos": {
+				CacheSuffixes: []string{".rpm"},
+				Mirrors:       []string{"http://mirror.example.com:8080/centos/", "http://deb.debian.org/debian/centos/"},
+			},
+		},
+	}
+	require.NoError(t, validateConfig(repoConfig))
+	pp := New(&PkgProxyConfig{CacheBasePath: t.TempDir(), RepositoryConfig: repoConfig}).(*pkgProxy)
+
+	tests := []struct {
+		url string
+		uri string
+	}{
+		{"http://deb.debian.org/debian/dists/trixie/InRelease", "/debian/dists/trixie/InRelease"},
+		{"http://DEB.debian.org:80/debian/pool/a.deb?x=1", "/debian/pool/a.deb?x=1"},
+		{"http://deb.debian.org/debian-security/pool/a.deb", "/debian-security/pool/a.deb"},
+		{"http://deb.debian.org/debian/centos/a.rpm", "/centos/a.rpm"},
+		{"http://mirror.example.com:8080/centos/a.rpm", "/centos/a.rpm"},
+		{"http://mirror.example.com/centos/a.rpm", ""},
+		{"http://deb.debian.org/debian", ""},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		require.NoError(t, err)
+		rewritten, ok := pp.matchProxyRequest(u)
+		if tt.uri == "" {
+			assert.False(t, ok, tt.url)
+			continue
+		}
+		require.True(t, ok, tt.url)
+		assert.Equal(t, tt.uri, rewritten.RequestURI(), tt.url)
+	}
+}
@@ -6,10 +6,16 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"time"
 
+	"github.com/ganto/pkgproxy/pkg/cache"
+	"github.com/ganto/pkgproxy/pkg/utils"
 	yaml "gopkg.in/yaml.v3"
 )
 
@@ -18,14 +24,169 @@ var repoHandleRegexp = regexp.MustCompile("^[a-zA-Z0-9_~.-]*$")
 
 // RepoConfig defines the upstream package repositories
 type RepoConfig struct {
-	Repositories map[string]Repository `yaml:"repositories"`
+	Deduplicate   bool                  `yaml:"deduplicate,omitempty"`
+	MaxSize       ByteSize              `yaml:"max_size,omitempty"`
+	Repositories  map[string]Repository `yaml:"repositories"`
+	Storage       *StorageConfig        `yaml:"storage,omitempty"`
+	UpstreamProxy string                `yaml:"upstream_proxy,omitempty"`
 }
 
 type Repository struct {
-	CacheSuffixes []string `yaml:"suffixes"`
-	Exclude       []string `yaml:"exclude,omitempty"`
-	Mirrors       []string `yaml:"mirrors"`
-	Retries       int      `yaml:"retries,omitempty"`
+	Access        *AccessConfig       `yaml:"access,omitempty"`
+	Auth          *AuthConfig         `yaml:"auth,omitempty"`
+	CacheSuffixes []string            `yaml:"suffixes"`
+	Exclude       []string            `yaml:"exclude,omitempty"`
+	MaxSize       ByteSize            `yaml:"max_size,omitempty"`
+	Metadata      *MetadataConfig     `yaml:"metadata,omitempty"`
+	Metalink      string              `yaml:"metalink,omitempty"`
+	MirrorHealth  *MirrorHealthConfig `yaml:"mirror_health,omitempty"`
+	Mirrorlist    string              `yaml:"mirrorlist,omitempty"`
+	MirrorPath    string              `yaml:"mirror_path,omitempty"`
+	MirrorRefresh time.Duration       `yaml:"mirror_refresh,omitempty"`
+	Mirrors       []string            `yaml:"mirrors"`
+	NegativeTTL   time.Duration       `yaml:"negative_ttl,omitempty"`
+	Offline       bool                `yaml:"offline,omitempty"`
+	Parent        string              `yaml:"parent,omitempty"`
+	Retries       int                 `yaml:"retries,omitempty"`
+	Transport     *TransportConfig    `yaml:"transport,omitempty"`
+	UpstreamProxy string              `yaml:"upstream_proxy,omitempty"`
+}
+
+// AccessConfig restricts which clients may access a repository. Clients are
+// matched by their IP address against the deny and allow lists of CIDRs or
+// IP addresses. If users or tokens are configured, clients must additionally
+// authenticate with basic auth or a bearer token.
+type AccessConfig struct {
+	Allow  []string          `yaml:"allow,omitempty"`
+	Deny   []string          `yaml:"deny,omitempty"`
+	Users  map[string]Secret `yaml:"users,omitempty"`
+	Tokens []Secret          `yaml:"tokens,omitempty"`
+}
+
+// AuthConfig defines the credentials sent to the mirrors of a private
+// repository. Username and password are sent as basic auth, a token as bearer
+// token. The secrets are read from files or environment variables.
+type AuthConfig struct {
+	Username string            `yaml:"username,omitempty"`
+	Password *Secret           `yaml:"password,omitempty"`
+	Token    *Secret           `yaml:"token,omitempty"`
+	Headers  map[string]Secret `yaml:"headers,omitempty"`
+	TLSCert  string            `yaml:"tls_cert,omitempty"`
+	TLSKey   string            `yaml:"tls_key,omitempty"`
+}
+
+// Secret is a value read from a file or an environment variable, so that it
+// doesn't have to be written into the configuration file.
+type Secret struct {
+	File string `yaml:"file,omitempty"`
+	Env  string `yaml:"env,omitempty"`
+}
+
+// TransportConfig defines the HTTP transport used for the upstream requests
+// of a repository. Zero values keep the defaults of the Go HTTP client.
+type TransportConfig struct {
+	// PEM bundle of CA certificates trusted in addition to the system CAs
+	CAFile                string        `yaml:"ca_file,omitempty"`
+	InsecureSkipVerify    bool          `yaml:"insecure_skip_verify,omitempty"`
+	DialTimeout           time.Duration `yaml:"dial_timeout,omitempty"`
+	TLSHandshakeTimeout   time.Duration `yaml:"tls_handshake_timeout,omitempty"`
+	ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout,omitempty"`
+	IdleConnTimeout       time.Duration `yaml:"idle_conn_timeout,omitempty"`
+	MaxIdleConns          int           `yaml:"max_idle_conns,omitempty"`
+	MaxIdleConnsPerHost   int           `yaml:"max_idle_conns_per_host,omitempty"`
+	MaxConnsPerHost       int           `yaml:"max_conns_per_host,omitempty"`
+	// Enable or disable HTTP/2, enabled by default
+	HTTP2 *bool `yaml:"http2,omitempty"`
+}
+
+// MirrorHealthConfig defines when a failing mirror is skipped and how the
+// mirrors are ordered.
+type MirrorHealthConfig struct {
+	FailureThreshold int           `yaml:"failure_threshold,omitempty"`
+	CoolOff          time.Duration `yaml:"cool_off,omitempty"`
+	OrderByLatency   bool          `yaml:"order_by_latency,omitempty"`
+}
+
+// MetadataConfig defines which files of a repository are metadata that is
+// cached but revalidated with the upstream mirrors once it is older than
+// MaxAge. If the revalidation fails, the cached copy is still served until it
+// is older than MaxAge plus StaleIfError.
+type MetadataConfig struct {
+	Patterns     []string      `yaml:"patterns"`
+	MaxAge       time.Duration `yaml:"max_age,omitempty"`
+	StaleIfError time.Duration `yaml:"stale_if_error,omitempty"`
+}
+
+// StorageConfig defines where the cached files are stored. The files are
+// stored in the local cache directory if no backend is configured.
+type StorageConfig struct {
+	S3 *S3StorageConfig `yaml:"s3,omitempty"`
+}
+
+// S3StorageConfig defines an S3 compatible object storage shared by multiple
+// pkgproxy instances. The credentials are read from the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+type S3StorageConfig struct {
+	Endpoint string `yaml:"endpoint"`
+	Region   string `yaml:"region,omitempty"`
+	Bucket   string `yaml:"bucket"`
+	Prefix   string `yaml:"prefix,omitempty"`
+}
+
+// ByteSize is a size in bytes which can be given as plain number or with a
+// binary unit suffix (e.g. "500M", "10GiB") in the configuration.
+type ByteSize int64
+
+func (b *ByteSize) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	n, err := utils.ParseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = ByteSize(n)
+	return nil
+}
+
+// CacheConfig returns the cache configuration of the repository for the given
+// cache base path.
+func (r *Repository) CacheConfig(basePath string) *cache.CacheConfig {
+	var metadataPatterns []string
+	if r.Metadata != nil {
+		metadataPatterns = r.Metadata.Patterns
+	}
+	return &cache.CacheConfig{
+		BasePath:     basePath,
+		FileSuffixes: r.CacheSuffixes,
+		Exclude:      r.Exclude,
+		Metadata:     metadataPatterns,
+	}
+}
+
+// NewStorage returns the configured cache storage backend or nil if the files
+// are stored in the local cache directory. Temp files of downloads in progress
+// are always written below basePath.
+func (r *RepoConfig) NewStorage(basePath string) (cache.Storage, error) {
+	if r.Storage == nil || r.Storage.S3 == nil {
+		return nil, nil
+	}
+	accessKeyID := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretAccessKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKeyID == "" || secretAccessKey == "" {
+		return nil, errors.New("missing S3 credentials: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+	return cache.NewS3Storage(&cache.S3Config{
+		Endpoint:        r.Storage.S3.Endpoint,
+		Region:          r.Storage.S3.Region,
+		Bucket:          r.Storage.S3.Bucket,
+		Prefix:          r.Storage.S3.Prefix,
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		TempPath:        basePath,
+	})
 }
 
 func LoadConfig(config *RepoConfig, path string) error {
@@ -54,16 +215,110 @@ func validateConfig(config *RepoConfig) error {
 	if config.Repositories == nil {
 		return errors.New("missing required key 'repositories'")
 	}
+	if config.MaxSize < 0 {
+		return errors.New("invalid max_size: must not be negative")
+	}
+	if config.UpstreamProxy != "" && config.UpstreamProxy != directProxy {
+		if _, err := parseProxy(config.UpstreamProxy); err != nil {
+			return fmt.Errorf("invalid upstream_proxy: %w", err)
+		}
+	}
+	remoteStorage := config.Storage != nil && config.Storage.S3 != nil
+	if remoteStorage {
+		s3 := config.Storage.S3
+		if u, err := url.Parse(s3.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid storage s3 endpoint: %q", s3.Endpoint)
+		}
+		if s3.Bucket == "" {
+			return errors.New("missing required key for storage s3: bucket")
+		}
+		if config.MaxSize != 0 {
+			return errors.New("invalid max_size: not supported with s3 storage")
+		}
+		if config.Deduplicate {
+			return errors.New("invalid deduplicate: not supported with s3 storage")
+		}
+	}
 	for handle, repoConfig := range config.Repositories {
 		if alphanum := repoHandleRegexp.MatchString(handle); !alphanum {
 			return fmt.Errorf("invalid repository name '%s'. Must be alphanumeric or in '-', '_', '.', '~'", handle)
 		}
+		if "/"+handle == AdminPrefix {
+			return fmt.Errorf("invalid repository name '%s'. The name is reserved for the admin API", handle)
+		}
+		if handle == cache.BlobDir {
+			return fmt.Errorf("invalid repository name '%s'. The name is reserved for the deduplicated files", handle)
+		}
 		if repoConfig.CacheSuffixes == nil {
 			return fmt.Errorf("missing required key for repository '%s': suffixes", handle)
 		}
-		if repoConfig.Mirrors == nil {
+		if repoConfig.Mirrors == nil && repoConfig.Metalink == "" && repoConfig.Mirrorlist == "" && repoConfig.Parent == "" {
 			return fmt.Errorf("missing required key for repository '%s': mirrors", handle)
 		}
+		if repoConfig.Metalink != "" && repoConfig.Mirrorlist != "" {
+			return fmt.Errorf("invalid repository '%s': metalink and mirrorlist are mutually exclusive", handle)
+		}
+		for key, value := range map[string]string{"metalink": repoConfig.Metalink, "mirrorlist": repoConfig.Mirrorlist, "parent": repoConfig.Parent} {
+			if u, err := url.Parse(value); value != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+				return fmt.Errorf("invalid %s URL for repository '%s': %q", key, handle, value)
+			}
+		}
+		if repoConfig.Access != nil {
+			if _, err := newAccessControl(repoConfig.Access); err != nil {
+				return fmt.Errorf("invalid access for repository '%s': %w", handle, err)
+			}
+		}
+		if repoConfig.Auth != nil {
+			if err := validateAuth(repoConfig.Auth); err != nil {
+				return fmt.Errorf("invalid auth for repository '%s': %w", handle, err)
+			}
+		}
+		if repoConfig.UpstreamProxy != "" && repoConfig.UpstreamProxy != directProxy {
+			if _, err := parseProxy(repoConfig.UpstreamProxy); err != nil {
+				return fmt.Errorf("invalid upstream_proxy for repository '%s': %w", handle, err)
+			}
+		}
+		if repoConfig.Transport != nil {
+			if err := validateTransport(repoConfig.Transport); err != nil {
+				return fmt.Errorf("invalid transport for repository '%s': %w", handle, err)
+			}
+			if repoConfig.Transport.InsecureSkipVerify {
+				slog.Warn("TLS certificate verification disabled", "repository", handle)
+			}
+		}
+		if repoConfig.NegativeTTL < 0 {
+			return fmt.Errorf("invalid negative_ttl for repository '%s': must not be negative", handle)
+		}
+		if repoConfig.MirrorRefresh < 0 {
+			return fmt.Errorf("invalid mirror_refresh for repository '%s': must not be negative", handle)
+		}
+		if repoConfig.MaxSize < 0 {
+			return fmt.Errorf("invalid max_size for repository '%s': must not be negative", handle)
+		}
+		if repoConfig.MaxSize != 0 && remoteStorage {
+			return fmt.Errorf("invalid max_size for repository '%s': not supported with s3 storage", handle)
+		}
+		if repoConfig.MirrorHealth != nil {
+			if repoConfig.MirrorHealth.FailureThreshold < 0 {
+				return fmt.Errorf("invalid mirror_health failure_threshold for repository '%s': must not be negative", handle)
+			}
+			if repoConfig.MirrorHealth.CoolOff < 0 {
+				return fmt.Errorf("invalid mirror_health cool_off for repository '%s': must not be negative", handle)
+			}
+		}
+		if repoConfig.Metadata != nil {
+			for _, pattern := range repoConfig.Metadata.Patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return fmt.Errorf("invalid metadata pattern for repository '%s': %q", handle, pattern)
+				}
+			}
+			if repoConfig.Metadata.MaxAge < 0 {
+				return fmt.Errorf("invalid metadata max_age for repository '%s': must not be negative", handle)
+			}
+			if repoConfig.Metadata.StaleIfError < 0 {
+				return fmt.Errorf("invalid metadata stale_if_error for repository '%s': must not be negative", handle)
+			}
+		}
 		// Warn if suffixes contains "*" alongside other entries (redundant).
 		hasWildcard := false
 		var redundant []string
@@ -81,3 +336,49 @@ func validateConfig(config *RepoConfig) error {
 	}
 	return nil
 }
+
+// validateAuth verifies the auth configuration and that its secrets and the
+// TLS client certificate can be loaded.
+func validateAuth(auth *AuthConfig) error {
+	if auth.Password != nil && auth.Username == "" {
+		return errors.New("password requires username")
+	}
+	if auth.Password != nil && auth.Token != nil {
+		return errors.New("password and token are mutually exclusive")
+	}
+	if (auth.TLSCert == "") != (auth.TLSKey == "") {
+		return errors.New("tls_cert and tls_key must be set together")
+	}
+	_, err := newUpstreamAuth(auth, nil, http.DefaultTransport)
+	return err
+}
+
+// validateTransport verifies the transport configuration and that the CA
+// bundle can be loaded.
+func validateTransport(transport *TransportConfig) error {
+	for key, value := range map[string]time.Duration{
+		"dial_timeout":            transport.DialTimeout,
+		"tls_handshake_timeout":   transport.TLSHandshakeTimeout,
+		"response_header_timeout": transport.ResponseHeaderTimeout,
+		"idle_conn_timeout":       transport.IdleConnTimeout,
+	} {
+		if value < 0 {
+			return fmt.Errorf("%s must not be negative", key)
+		}
+	}
+	for key, value := range map[string]int{
+		"max_idle_conns":          transport.MaxIdleConns,
+		"max_idle_conns_per_host": transport.MaxIdleConnsPerHost,
+		"max_conns_per_host":      transport.MaxConnsPerHost,
+	} {
+		if value < 0 {
+			return fmt.Errorf("%s must not be negative", key)
+		}
+	}
+	if transport.CAFile != "" {
+		if _, err := loadCertPool(transport.CAFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
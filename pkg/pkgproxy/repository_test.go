@@ -5,7 +5,10 @@ package pkgproxy
 import (
 	"bytes"
 	"log/slog"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -60,3 +63,155 @@ func TestValidateConfigWildcardAloneNoWarning(t *testing.T) {
 
 	assert.Empty(t, buf.String())
 }
+
+func TestLoadConfigMaxSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pkgproxy.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+max_size: 10GiB
+repositories:
+  testrepo:
+    suffixes: [.rpm]
+    max_size: 500M
+    mirrors: [https://example.com/]
+  other:
+    suffixes: [.deb]
+    mirrors: [https://example.com/]
+`), 0o600))
+
+	var config RepoConfig
+	require.NoError(t, LoadConfig(&config, path))
+	assert.Equal(t, ByteSize(10<<30), config.MaxSize)
+	assert.Equal(t, ByteSize(500<<20), config.Repositories["testrepo"].MaxSize)
+	assert.Equal(t, ByteSize(0), config.Repositories["other"].MaxSize)
+}
+
+func TestLoadConfigInvalidMaxSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pkgproxy.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+repositories:
+  testrepo:
+    suffixes: [.rpm]
+    max_size: lots
+    mirrors: [https://example.com/]
+`), 0o600))
+
+	var config RepoConfig
+	assert.Error(t, LoadConfig(&config, path))
+}
+
+func TestValidateConfigInvalidMirrorHealth(t *testing.T) {
+	for _, mirrorHealth := range []*MirrorHealthConfig{
+		{FailureThreshold: -1},
+		{CoolOff: -time.Second},
+	} {
+		config := &RepoConfig{
+			Repositories: map[string]Repository{
+				"fedora": {
+					CacheSuffixes: []string{".rpm"},
+					Mirrors:       []string{"https://example.com/"},
+					MirrorHealth:  mirrorHealth,
+				},
+			},
+		}
+		assert.Error(t, validateConfig(config))
+	}
+}
+
+func TestValidateConfigMirrorSource(t *testing.T) {
+	tests := []struct {
+		name  string
+		repo  Repository
+		valid bool
+	}{
+		{"metalink without mirrors", Repository{Metalink: "https://mirrors.example.com/metalink?repo=fedora-42"}, true},
+		{"mirrorlist with mirrors", Repository{Mirrorlist: "https://mirrors.example.com/mirrorlist", Mirrors: []string{"https://example.com/"}}, true},
+		{"metalink and mirrorlist", Repository{Metalink: "https://mirrors.example.com/metalink", Mirrorlist: "https://mirrors.example.com/mirrorlist"}, false},
+		{"invalid metalink URL", Repository{Metalink: "mirrors.example.com/metalink"}, false},
+		{"negative refresh", Repository{Mirrorlist: "https://mirrors.example.com/mirrorlist", MirrorRefresh: -time.Minute}, false},
+		{"parent without mirrors", Repository{Parent: "http://pkgproxy.example.com:8080/fedora/"}, true},
+		{"invalid parent URL", Repository{Parent: "pkgproxy.example.com/fedora/", Mirrors: []string{"https://example.com/"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.repo.CacheSuffixes = []string{".rpm"}
+			config := &RepoConfig{Repositories: map[string]Repository{"fedora": tt.repo}}
+			if tt.valid {
+				assert.NoError(t, validateConfig(config))
+			} else {
+				assert.Error(t, validateConfig(config))
+			}
+		})
+	}
+}
+
+func TestValidateConfigReservedRepositoryName(t *testing.T) {
+	for _, name := range []string{"_admin", ".blobs"} {
+		config := &RepoConfig{
+			Repositories: map[string]Repository{
+				name: {
+					CacheSuffixes: []string{".rpm"},
+					Mirrors:       []string{"https://example.com/"},
+				},
+			},
+		}
+		assert.Error(t, validateConfig(config), name)
+	}
+}
+
+func TestValidateConfigStorage(t *testing.T) {
+	s3 := func(endpoint string, bucket string) *StorageConfig {
+		return &StorageConfig{S3: &S3StorageConfig{Endpoint: endpoint, Bucket: bucket}}
+	}
+	tests := []struct {
+		name   string
+		config RepoConfig
+		valid  bool
+	}{
+		{"local", RepoConfig{Storage: &StorageConfig{}}, true},
+		{"s3", RepoConfig{Storage: s3("http://localhost:9000", "pkgproxy")}, true},
+		{"invalid endpoint", RepoConfig{Storage: s3("localhost:9000", "pkgproxy")}, false},
+		{"missing bucket", RepoConfig{Storage: s3("http://localhost:9000", "")}, false},
+		{"s3 with max_size", RepoConfig{Storage: s3("http://localhost:9000", "pkgproxy"), MaxSize: 1 << 30}, false},
+		{"s3 with deduplicate", RepoConfig{Storage: s3("http://localhost:9000", "pkgproxy"), Deduplicate: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Repositories = map[string]Repository{
+				"fedora": {CacheSuffixes: []string{".rpm"}, Mirrors: []string{"https://example.com/"}},
+			}
+			if tt.valid {
+				assert.NoError(t, validateConfig(&tt.config))
+			} else {
+				assert.Error(t, validateConfig(&tt.config))
+			}
+		})
+	}
+
+	// quotas of a repository are not supported with s3 either
+	config := &RepoConfig{
+		Storage: s3("http://localhost:9000", "pkgproxy"),
+		Repositories: map[string]Repository{
+			"fedora": {CacheSuffixes: []string{".rpm"}, Mirrors: []string{"https://example.com/"}, MaxSize: 1 << 30},
+		},
+	}
+	assert.Error(t, validateConfig(config))
+}
+
+func TestNewStorage(t *testing.T) {
+	config := &RepoConfig{}
+	storage, err := config.NewStorage(t.TempDir())
+	require.NoError(t, err)
+	assert.Nil(t, storage)
+
+	config.Storage = &StorageConfig{S3: &S3StorageConfig{Endpoint: "http://localhost:9000", Bucket: "pkgproxy"}}
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	_, err = config.NewStorage(t.TempDir())
+	assert.ErrorContains(t, err, "missing S3 credentials")
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "minioadmin")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "minioadmin")
+	storage, err = config.NewStorage(t.TempDir())
+	require.NoError(t, err)
+	assert.NotNil(t, storage)
+}
@@ -0,0 +1,214 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package pkgproxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ganto/pkgproxy/pkg/cache"
+	echo "github.com/labstack/echo/v5"
+)
+
+// revalidate makes sure the cached metadata file for uri is fresh before it
+// is served from the cache. Once the cached copy is older than the configured
+// max_age, it is revalidated with the upstream mirrors using its modification
+// time and stored ETag. A 304 response marks the cached copy as fresh again and
+// a 200 response replaces it, unless the upstream marked it as not cacheable. If all mirrors failed, the cached copy is served
+// as long as it is within the stale_if_error window. Any other upstream
+// response is passed on to the client, in which case served is true.
+func (pp *pkgProxy) revalidate(c *echo.Context, repo string, uri string) (served bool, err error) {
+	rid := requestID(c)
+	repoCache := pp.upstreams[repo].cache
+
+	meta, err := repoCache.GetMetadata(uri)
+	if err != nil {
+		slog.Warn("cache metadata read failed", "request_id", rid, "uri", uri, "error", err)
+		meta = &cache.Metadata{}
+	}
+	maxAge := pp.upstreams[repo].metadataMaxAge
+	if clientMaxAge, ok := requestMaxAge(c.Request().Header); ok && clientMaxAge < maxAge {
+		// e.g. a child pkgproxy with a shorter max_age
+		maxAge = clientMaxAge
+	}
+	if time.Since(meta.Validated) < maxAge {
+		setETag(c, meta)
+		return false, nil
+	}
+
+	info, err := repoCache.Stat(uri)
+	if err != nil {
+		return true, c.JSON(http.StatusInternalServerError, map[string]string{jsonKeyMessage: err.Error()})
+	}
+
+	ctx, cancel := upstreamContext(c.Request())
+	defer cancel()
+
+	// Always fetch the full file, even if the client only asked for the headers
+	// or a range of it.
+	req := c.Request().Clone(ctx)
+	req.Method = http.MethodGet
+	req.Header = filterHeaders(c.Request().Header, allowedRequestHeaders)
+	req.Header.Del("Range")
+	req.Header.Set("If-Modified-Since", info.ModTime().UTC().Format(http.TimeFormat))
+	if meta.ETag != "" {
+		req.Header.Set("If-None-Match", meta.ETag)
+	} else {
+		req.Header.Del("If-None-Match")
+	}
+
+	slog.Info("cache revalidate", "request_id", rid, "uri", uri, "validated", meta.Validated)
+	rsp, err := pp.tryMirrors(ctx, rid, req, repo, nil)
+	if rsp != nil {
+		defer rsp.Body.Close()
+	}
+	if err != nil {
+		if pp.serveStale(c, repo, uri, meta, info.ModTime(), err.Error()) {
+			return false, nil
+		}
+		return true, echo.NewHTTPError(http.StatusBadGateway, fmt.Sprintf("request to upstream server failed: %v", err)).Wrap(err)
+	}
+	if rsp == nil {
+		if pp.serveStale(c, repo, uri, meta, info.ModTime(), "no mirror returned a response") {
+			return false, nil
+		}
+		return true, echo.NewHTTPError(http.StatusBadGateway, "no mirror returned a response")
+	}
+
+	switch rsp.StatusCode {
+	case http.StatusNotModified:
+		meta.Validated = time.Now()
+		if err := repoCache.SetMetadata(uri, meta); err != nil {
+			slog.Error("cache metadata write failed", "request_id", rid, "uri", uri, "error", err)
+		}
+		setETag(c, meta)
+		return false, nil
+	case http.StatusOK:
+		if !isCacheable(rsp.Header) {
+			// the fresh copy is passed on, the previous one is kept
+			slog.Info("cache refresh skipped", "request_id", rid, "uri", uri, "error", errNotCacheable)
+			c.Response().Header().Set(headerCacheable, "false")
+			copyResponse(c.Response(), rsp)
+			return true, nil
+		}
+		if err := storeResponse(repoCache, rid, uri, rsp, nil, ""); err != nil {
+			// the previous copy is still in place and served instead
+			slog.Warn("cache refresh failed", "request_id", rid, "uri", uri, "error", err)
+			pp.metrics.cacheCommitFailures.WithLabelValues(repo).Inc()
+			setETag(c, meta)
+			return false, nil
+		}
+		pp.metrics.cacheCommits.WithLabelValues(repo).Inc()
+		setETag(c, &cache.Metadata{ETag: rsp.Header.Get("Etag")})
+		return false, nil
+	default:
+		if rsp.StatusCode >= http.StatusInternalServerError && pp.serveStale(c, repo, uri, meta, info.ModTime(), rsp.Status) {
+			return false, nil
+		}
+		copyResponse(c.Response(), rsp)
+		return true, nil
+	}
+}
+
+// serveStale reports whether the cached copy of uri may be served after its
+// revalidation failed, i.e. it was validated no longer than max_age plus
+// stale_if_error ago. If so, the Warning and Age headers are set on the
+// response. Without a recorded validation, e.g. if the sidecar file is
+// missing, the modification time of the cached file is used instead.
+func (pp *pkgProxy) serveStale(c *echo.Context, repo string, uri string, meta *cache.Metadata, modTime time.Time, reason string) bool {
+	upstream := pp.upstreams[repo]
+	validated := meta.Validated
+	if validated.IsZero() {
+		validated = modTime
+	}
+	age := time.Since(validated)
+	if upstream.staleIfError <= 0 || age > upstream.metadataMaxAge+upstream.staleIfError {
+		return false
+	}
+	slog.Warn("serving stale metadata", "request_id", requestID(c), "uri", uri, "age", age.Round(time.Second), "error", reason)
+	c.Response().Header().Set("Warning", `111 - "Revalidation Failed"`)
+	c.Response().Header().Set("Age", strconv.FormatInt(int64(age.Seconds()), 10))
+	setETag(c, meta)
+	return true
+}
+
+// storeResponse writes the body of the upstream response to the cache for the
+// given URI, replacing an existing copy. If dl is not nil, it is notified about
+// the data written to the temp file. If checksum is not empty, the file is
+// only committed if its SHA-256 checksum matches; dl then isn't notified, so
+// that concurrent requests never read the unverified temp file.
+func storeResponse(fc cache.FileCache, rid string, uri string, rsp *http.Response, dl *download, checksum string) error {
+	if !isCacheable(rsp.Header) {
+		return errNotCacheable
+	}
+	tmpFile, err := fc.CreateTempWriter(uri)
+	if err != nil {
+		return err
+	}
+	tmpPath := tmpFile.Name()
+	defer func() {
+		// CommitTempFile renames the file; the Remove becomes a harmless ENOENT
+		_ = os.Remove(tmpPath)
+	}()
+
+	if checksum != "" {
+		dl = nil
+	}
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(&progressWriter{file: tmpFile, download: dl}, hash), rsp.Body)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if clHeader := rsp.Header.Get("Content-Length"); clHeader != "" {
+		if expectedLen, err := strconv.ParseInt(clHeader, 10, 64); err == nil && n != expectedLen {
+			return fmt.Errorf("content-length mismatch: expected %d, got %d", expectedLen, n)
+		}
+	}
+	if checksum != "" {
+		if sum := hex.EncodeToString(hash.Sum(nil)); sum != checksum {
+			return fmt.Errorf("%w: expected %s, got %s", errChecksumMismatch, checksum, sum)
+		}
+	}
+
+	timestamp := time.Now().Local()
+	if rsp.Header.Get("Last-Modified") != "" {
+		timestamp, _ = http.ParseTime(rsp.Header.Get("Last-Modified"))
+	}
+	if err := fc.CommitTempFile(tmpPath, uri, timestamp); err != nil {
+		return err
+	}
+	if fc.IsMetadata(uri) {
+		storeValidators(fc, rid, uri, rsp.Header)
+	}
+	return nil
+}
+
+// storeValidators records the ETag of a freshly fetched metadata file and
+// marks it as validated.
+func storeValidators(fc cache.FileCache, rid string, uri string, header http.Header) {
+	meta := &cache.Metadata{
+		ETag:      header.Get("Etag"),
+		Validated: time.Now(),
+	}
+	if err := fc.SetMetadata(uri, meta); err != nil {
+		slog.Error("cache metadata write failed", "request_id", rid, "uri", uri, "error", err)
+	}
+}
+
+// setETag sets the stored ETag on the response served from the cache, so that
+// conditional client requests can be answered with 304.
+func setETag(c *echo.Context, meta *cache.Metadata) {
+	if meta.ETag != "" {
+		c.Response().Header().Set("Etag", meta.ETag)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package pkgproxy
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ganto/pkgproxy/pkg/utils"
+	echo "github.com/labstack/echo/v5"
+)
+
+// resolveSnapshot handles requests to a snapshot of a repository, e.g.
+// "/fedora@2026-10-01/...". Metadata is served from the snapshot store and
+// never revalidated. All other requests are rewritten to the URI of the
+// repository, so that packages are served from the shared cache. It returns
+// true if the request was answered.
+func (pp *pkgProxy) resolveSnapshot(c *echo.Context) (bool, error) {
+	req := c.Request()
+	repo, snapshot, ok := getSnapshotFromURI(req.RequestURI)
+	if !ok || !pp.isRepositoryRequest(req.RequestURI) {
+		return false, nil
+	}
+	if !utils.Contains(allowedProxyMethods, req.Method) {
+		return true, c.JSON(http.StatusMethodNotAllowed, map[string]string{jsonKeyMessage: fmt.Sprintf("Snapshot does not allow method %s\n", req.Method)})
+	}
+	if pp.snapshots == nil || !pp.snapshots.Exists(repo, snapshot) {
+		return true, c.JSON(http.StatusNotFound, map[string]string{jsonKeyMessage: "Unknown snapshot"})
+	}
+
+	prefix := "/" + repo + "@" + snapshot
+	uri := "/" + repo + strings.TrimPrefix(req.URL.Path, prefix)
+	if pp.upstreams[repo].cache.IsMetadata(uri) {
+		return true, pp.serveSnapshot(c, repo, snapshot, uri)
+	}
+	slog.Debug("snapshot passthrough", "request_id", requestID(c), "snapshot", snapshot, "uri", uri)
+	req.RequestURI = "/" + repo + strings.TrimPrefix(req.RequestURI, prefix)
+	req.URL.Path = uri
+	req.URL.RawPath = ""
+	return false, nil
+}
+
+// serveSnapshot serves the metadata file for uri from the named snapshot of
+// repo.
+func (pp *pkgProxy) serveSnapshot(c *echo.Context, repo string, snapshot string, uri string) error {
+	filePath, err := pp.snapshots.GetFilePath(repo, snapshot, uri)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c.JSON(http.StatusNotFound, map[string]string{jsonKeyMessage: "Not Found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{jsonKeyMessage: "Forbidden"})
+	}
+	pp.metrics.cacheHits.WithLabelValues(repo).Inc()
+	defer pp.metrics.countServed(c, repo, sourceCache, responseSize(c))
+	return c.FileFS(filepath.Base(filePath), os.DirFS(filepath.Dir(filePath)))
+}
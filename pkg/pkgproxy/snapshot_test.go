@@ -0,0 +1,145 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package pkgproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ganto/pkgproxy/pkg/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withSnapshots enables the snapshot store of the test proxy.
+func withSnapshots(t *testing.T) func(*PkgProxyConfig) {
+	return func(config *PkgProxyConfig) {
+		config.SnapshotBasePath = t.TempDir()
+	}
+}
+
+func TestGetSnapshotFromURI(t *testing.T) {
+	repo, snapshot, ok := getSnapshotFromURI("/testrepo@2026-10-01/os/repodata/repomd.xml")
+	assert.True(t, ok)
+	assert.Equal(t, "testrepo", repo)
+	assert.Equal(t, "2026-10-01", snapshot)
+
+	repo, _, ok = getSnapshotFromURI("/testrepo/os/repodata/repomd.xml")
+	assert.False(t, ok)
+	assert.Equal(t, "testrepo", repo)
+}
+
+func TestCacheSnapshot(t *testing.T) {
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/os/repodata/repomd.xml":
+			_, _ = io.WriteString(w, "current")
+		case "/os/Packages/new.rpm":
+			_, _ = io.WriteString(w, "new package")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer mirror.Close()
+
+	pp, cacheDir := newTestProxyWithRepo(t, Repository{
+		Metadata: &MetadataConfig{Patterns: []string{"repomd.xml"}},
+		Mirrors:  []string{mirror.URL + "/"},
+	}, withSnapshots(t))
+	writeCachedFile(t, cacheDir, "/testrepo/os/repodata/repomd.xml", "frozen")
+	writeCachedFile(t, cacheDir, "/testrepo/os/Packages/old.rpm", "old package")
+	_, err := pp.snapshots.Create(pp.upstreams["testrepo"].cache, "testrepo", "2026-10-01")
+	require.NoError(t, err)
+	writeCachedFile(t, cacheDir, "/testrepo/os/repodata/repomd.xml", "updated")
+	app := newTestApp(pp)
+
+	get := func(uri string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, uri, nil))
+		return rec
+	}
+
+	// metadata is served from the snapshot
+	rec := get("/testrepo@2026-10-01/os/repodata/repomd.xml")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "frozen", rec.Body.String())
+
+	// packages are served from the shared cache or fetched from upstream
+	rec = get("/testrepo@2026-10-01/os/Packages/old.rpm")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "old package", rec.Body.String())
+	rec = get("/testrepo@2026-10-01/os/Packages/new.rpm")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "new package", rec.Body.String())
+	assert.FileExists(t, cacheDir+"/testrepo/os/Packages/new.rpm")
+
+	// metadata missing from the snapshot is never fetched from upstream
+	rec = get("/testrepo@2026-10-01/other/repodata/repomd.xml")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = get("/testrepo@missing/os/repodata/repomd.xml")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Unknown snapshot")
+
+	rec = adminRequest(app, http.MethodDelete, "/testrepo@2026-10-01/os/Packages/old.rpm", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.FileExists(t, cacheDir+"/testrepo/os/Packages/old.rpm")
+}
+
+func TestCacheSnapshotDisabled(t *testing.T) {
+	pp, _ := newTestProxy(t, []string{"http://localhost:1/"})
+	app := newTestApp(pp)
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/testrepo@2026-10-01/os/Packages/a.rpm", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestAdminSnapshots(t *testing.T) {
+	pp, cacheDir := newTestProxyWithRepo(t, Repository{
+		Metadata: &MetadataConfig{Patterns: []string{"repomd.xml"}},
+		Mirrors:  []string{"http://localhost:1/"},
+	}, withSnapshots(t))
+	app := newTestAdminApp(pp)
+	target := AdminPrefix + "/repositories/testrepo/snapshots"
+
+	rec := adminRequest(app, http.MethodPost, target, `{"name": "2026-10-01"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code, "nothing to snapshot")
+
+	writeCachedFile(t, cacheDir, "/testrepo/os/repodata/repomd.xml", "metadata")
+	writeCachedFile(t, cacheDir, "/testrepo/os/Packages/a.rpm", "package")
+	rec = adminRequest(app, http.MethodPost, target, `{"name": "2026-10-01"}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var snapshot cache.Snapshot
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &snapshot))
+	assert.Equal(t, "2026-10-01", snapshot.Name)
+	assert.Equal(t, 1, snapshot.Files)
+
+	rec = adminRequest(app, http.MethodPost, target, `{"name": "2026-10-01"}`)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	for _, body := range []string{`{"name": "../x"}`, `{}`, `invalid`} {
+		rec = adminRequest(app, http.MethodPost, target, body)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+
+	rec = adminRequest(app, http.MethodGet, target, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var snapshots []cache.Snapshot
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &snapshots))
+	require.Len(t, snapshots, 1)
+	assert.Equal(t, "testrepo", snapshots[0].Repository)
+
+	rec = adminRequest(app, http.MethodDelete, fmt.Sprintf("%s/%s", target, "2026-10-01"), "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = adminRequest(app, http.MethodDelete, fmt.Sprintf("%s/%s", target, "2026-10-01"), "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = adminRequest(app, http.MethodDelete, fmt.Sprintf("%s/%s", target, "..."), "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = adminRequest(app, http.MethodGet, AdminPrefix+"/repositories/unknown/snapshots", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,125 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package pkgproxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/ganto/pkgproxy/pkg/utils"
+)
+
+// Keep-alive period of the connections of a transport with a dial timeout,
+// same as for http.DefaultTransport
+const defaultKeepAlive = 30 * time.Second
+
+// Value of upstream_proxy to connect to the mirrors without proxy
+const directProxy = "direct"
+
+// Proxy URL schemes supported by http.Transport
+var proxySchemes = []string{"http", "https", "socks5", "socks5h"}
+
+// newTransport returns a clone of base with the transport options and the
+// upstream proxy of a repository applied. base is returned as is if neither
+// is configured. An empty proxy keeps the proxy of base, by default taken
+// from the HTTP_PROXY environment variables.
+func newTransport(base http.RoundTripper, config *TransportConfig, proxy string) (http.RoundTripper, error) {
+	if config == nil && proxy == "" {
+		return base, nil
+	}
+	baseTransport, ok := base.(*http.Transport)
+	if !ok {
+		return nil, errors.New("unable to apply transport options to a custom transport")
+	}
+	t := baseTransport.Clone()
+	if proxy == directProxy {
+		t.Proxy = nil
+	} else if proxy != "" {
+		proxyURL, err := parseProxy(proxy)
+		if err != nil {
+			return nil, err
+		}
+		t.Proxy = http.ProxyURL(proxyURL)
+	}
+	if config == nil {
+		return t, nil
+	}
+
+	if config.CAFile != "" || config.InsecureSkipVerify {
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		t.TLSClientConfig.InsecureSkipVerify = config.InsecureSkipVerify //nolint:gosec // explicitly configured for lab mirrors
+	}
+	if config.CAFile != "" {
+		pool, err := loadCertPool(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		t.TLSClientConfig.RootCAs = pool
+	}
+	if config.DialTimeout > 0 {
+		dialer := &net.Dialer{Timeout: config.DialTimeout, KeepAlive: defaultKeepAlive}
+		t.DialContext = dialer.DialContext
+	}
+	if config.TLSHandshakeTimeout > 0 {
+		t.TLSHandshakeTimeout = config.TLSHandshakeTimeout
+	}
+	if config.ResponseHeaderTimeout > 0 {
+		t.ResponseHeaderTimeout = config.ResponseHeaderTimeout
+	}
+	if config.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = config.IdleConnTimeout
+	}
+	if config.MaxIdleConns > 0 {
+		t.MaxIdleConns = config.MaxIdleConns
+	}
+	if config.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+	}
+	if config.MaxConnsPerHost > 0 {
+		t.MaxConnsPerHost = config.MaxConnsPerHost
+	}
+	if config.HTTP2 != nil {
+		t.ForceAttemptHTTP2 = *config.HTTP2
+		if !*config.HTTP2 {
+			// a non-nil empty map disables HTTP/2
+			t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		}
+	}
+	return t, nil
+}
+
+// parseProxy parses the URL of an HTTP or SOCKS5 proxy. The error doesn't
+// contain the credentials of the URL.
+func parseProxy(proxy string) (*url.URL, error) {
+	u, err := url.Parse(proxy)
+	if err != nil || !utils.Contains(proxySchemes, u.Scheme) || u.Host == "" {
+		return nil, errors.New("must be 'direct' or an http, https, socks5 or socks5h URL")
+	}
+	return u, nil
+}
+
+// loadCertPool returns the system certificate pool extended with the
+// certificates of the PEM bundle at path.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path) //nolint:gosec // path from the configuration
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package pkgproxy
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/ganto/pkgproxy/pkg/cache"
+	"github.com/ganto/pkgproxy/pkg/repodata"
+	echo "github.com/labstack/echo/v5"
+)
+
+// errChecksumMismatch is returned when a downloaded file doesn't match the
+// checksum published in the repository metadata.
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// indexMetadata adds the package checksums listed in the cached repository
+// index file for uri to the checksum store. Files which were already indexed
+// in their current version are skipped, parsing happens in the background.
+func (pp *pkgProxy) indexMetadata(rid string, fc cache.FileCache, uri string) {
+	format, base := repodata.Detect(uri)
+	if format == repodata.Unknown {
+		return
+	}
+	info, err := fc.Stat(uri)
+	if err != nil || !pp.checksums.Claim(uri, info.ModTime()) {
+		return
+	}
+
+	go func() {
+		f, err := fc.Open(uri)
+		if err != nil {
+			slog.Error("repodata index failed", "request_id", rid, "uri", uri, "error", err)
+			return
+		}
+		defer f.Close()
+		checksums, err := repodata.Parse(format, f)
+		if err != nil {
+			slog.Error("repodata index failed", "request_id", rid, "uri", uri, "format", format, "error", err)
+			return
+		}
+		pp.checksums.Update(uri, base, checksums)
+		slog.Info("repodata indexed", "request_id", rid, "uri", uri, "format", format, "packages", len(checksums))
+	}()
+}
+
+// fetchVerified fetches the file for uri from the mirrors of repo and commits
+// it to the cache once its SHA-256 checksum matches the published checksum.
+// On a mismatch, the file is discarded, the mirror is recorded as failed and
+// the next mirror is tried. Nothing is written to the client before the file
+// was verified; the client and concurrent requests are then served from the
+// cache.
+func (pp *pkgProxy) fetchVerified(c *echo.Context, fc cache.FileCache, repo string, uri string, checksum string, dl *download) error {
+	rid := requestID(c)
+	complete := false
+	defer func() {
+		if !complete {
+			pp.downloads.release(uri, dl, false)
+		}
+	}()
+
+	ctx, cancel := upstreamContext(c.Request())
+	defer cancel()
+
+	// Always fetch the full file, even if the client only asked for a range
+	// of it.
+	req := c.Request().Clone(ctx)
+	req.Header = filterHeaders(c.Request().Header, allowedRequestHeaders)
+	req.Header.Del("Range")
+	for _, name := range conditionalRequestHeaders {
+		req.Header.Del(name)
+	}
+
+	var last *http.Response
+	var lastErr error
+	defer func() {
+		if last != nil {
+			_ = last.Body.Close()
+		}
+	}()
+	for i, mirror := range pp.mirrors(rid, repo) {
+		rsp, err := pp.tryMirror(ctx, rid, req, repo, i, mirror, nil)
+		if err != nil {
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		if last != nil {
+			_ = last.Body.Close()
+		}
+		last = rsp
+		if rsp.StatusCode != http.StatusOK {
+			continue
+		}
+		if !isCacheable(rsp.Header) {
+			// served without verification like any other uncached file
+			c.Response().Header().Set(headerCacheable, "false")
+			copyResponse(c.Response(), rsp)
+			return nil
+		}
+
+		err = storeResponse(fc, rid, uri, rsp, nil, checksum)
+		if err == nil {
+			pp.metrics.cacheCommits.WithLabelValues(repo).Inc()
+			complete = true
+			dl.setHeader(rsp.StatusCode, rsp.Header)
+			// let concurrent requests attach to the cached file right away
+			pp.downloads.release(uri, dl, true)
+			return pp.serveCached(c, fc, uri)
+		}
+		lastErr = err
+		pp.metrics.cacheCommitFailures.WithLabelValues(repo).Inc()
+		if errors.Is(err, errChecksumMismatch) {
+			slog.Error("cache checksum mismatch", "request_id", rid, "uri", uri, "mirror_index", i, "error", err)
+			pp.upstreams[repo].health.get(mirror).record(nil, err, false)
+		} else {
+			slog.Error("cache write failed", "request_id", rid, "uri", uri, "mirror_index", i, "error", err)
+		}
+	}
+
+	if last != nil && last.StatusCode != http.StatusOK {
+		copyResponse(c.Response(), last)
+		return nil
+	}
+	if last == nil && lastErr == nil && (pp.upstreams[repo].parent != nil || len(pp.mirrorList(repo)) > 0) {
+		lastErr = errAllCircuitsOpen
+	}
+	if lastErr != nil {
+		return echo.NewHTTPError(http.StatusBadGateway, fmt.Sprintf("request to upstream server failed: %v", lastErr)).Wrap(lastErr)
+	}
+	return echo.NewHTTPError(http.StatusBadGateway, "no mirror returned a response")
+}
@@ -3,7 +3,6 @@ package pkgproxy
 import (
 	"io"
 	"log/slog"
-	"os"
 
 	"github.com/ganto/pkgproxy/pkg/cache"
 )
@@ -15,9 +14,11 @@ import (
 type resilientWriter struct {
 	fc           cache.FileCache
 	uri          string
-	file         *os.File
+	file         cache.TempFile
 	failed       bool
 	bytesWritten int64
+	// optional in-progress download to notify about written data
+	download *download
 }
 
 func newResilientWriter(fc cache.FileCache, uri string) *resilientWriter {
@@ -42,6 +43,7 @@ func (w *resilientWriter) Write(b []byte) (int, error) {
 
 	n, err := w.file.Write(b)
 	w.bytesWritten += int64(n)
+	w.download.setProgress(w.file.Name(), w.bytesWritten)
 	if err != nil {
 		slog.Error("cache write failed", "uri", w.uri, "error", err)
 		w.failed = true
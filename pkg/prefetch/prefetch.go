@@ -0,0 +1,280 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+
+// Package prefetch downloads the packages listed in the metadata of a
+// repository through a running pkgproxy, so that subsequent client requests
+// are served from its cache.
+package prefetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/ganto/pkgproxy/pkg/repodata"
+)
+
+// Default number of packages downloaded in parallel
+var defaultConcurrency = 4
+
+// Preferred compression of the Debian Packages files, best first
+var debianPackagesSuffixes = []string{".xz", ".gz", ".bz2", ""}
+
+type Config struct {
+	// Base URL of the pkgproxy, e.g. "http://localhost:8080"
+	URL string
+
+	// Number of packages downloaded in parallel
+	Concurrency int
+
+	// Only download packages whose name or architecture matches. All
+	// packages are downloaded if nil.
+	Name *regexp.Regexp
+	Arch *regexp.Regexp
+
+	// HTTP client used for all requests. http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// Result summarizes a prefetch run.
+type Result struct {
+	// Number of packages matching the filters
+	Packages int
+	// Number of packages downloaded successfully
+	Fetched int
+	// Number of packages which failed to download
+	Failed int
+	// Number of bytes downloaded
+	Size int64
+}
+
+type Prefetcher struct {
+	base        *url.URL
+	client      *http.Client
+	concurrency int
+	name        *regexp.Regexp
+	arch        *regexp.Regexp
+}
+
+func New(cfg *Config) (*Prefetcher, error) {
+	base, err := url.Parse(cfg.URL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("invalid pkgproxy URL %q", cfg.URL)
+	}
+	p := &Prefetcher{
+		base:        base,
+		client:      cfg.Client,
+		concurrency: cfg.Concurrency,
+		name:        cfg.Name,
+		arch:        cfg.Arch,
+	}
+	if p.client == nil {
+		p.client = http.DefaultClient
+	}
+	if p.concurrency < 1 {
+		p.concurrency = defaultConcurrency
+	}
+	return p, nil
+}
+
+// Run downloads the packages listed in the metadata file at uri (e.g.
+// "/fedora/releases/42/Everything/x86_64/os/repodata/repomd.xml"). Supported
+// are the RPM repomd.xml and primary.xml, the Debian Release, InRelease and
+// Packages files and the Arch Linux package databases. The metadata is
+// fetched through pkgproxy as well.
+func (p *Prefetcher) Run(ctx context.Context, uri string) (*Result, error) {
+	indexes, err := p.indexes(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	var uris []string
+	seen := map[string]bool{}
+	for _, index := range indexes {
+		packages, err := p.packages(ctx, index)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", index, err)
+		}
+		for _, pkg := range packages {
+			if !seen[pkg] {
+				seen[pkg] = true
+				uris = append(uris, pkg)
+			}
+		}
+	}
+
+	result := &Result{Packages: len(uris)}
+	var mu sync.Mutex
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for range p.concurrency {
+		wg.Go(func() {
+			for pkg := range work {
+				size, err := p.download(ctx, pkg)
+				mu.Lock()
+				if err != nil {
+					slog.Warn("prefetch failed", "uri", pkg, "error", err)
+					result.Failed++
+				} else {
+					result.Fetched++
+					result.Size += size
+				}
+				mu.Unlock()
+			}
+		})
+	}
+	for _, pkg := range uris {
+		select {
+		case work <- pkg:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(work)
+	wg.Wait()
+	return result, ctx.Err()
+}
+
+// indexes returns the URIs of the index files listing the packages that are
+// referenced by the metadata file at uri.
+func (p *Prefetcher) indexes(ctx context.Context, uri string) ([]string, error) {
+	dir, name := path.Split(uri)
+	switch name {
+	case "repomd.xml":
+		body, err := p.get(ctx, uri)
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		locations, err := repodata.ParseRepomd(body)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", uri, err)
+		}
+		primary, ok := locations["primary"]
+		if !ok {
+			return nil, fmt.Errorf("%s: no primary metadata listed", uri)
+		}
+		// locations are relative to the parent of the repodata directory
+		return []string{path.Join(path.Dir(path.Clean(dir)), primary)}, nil
+
+	case "Release", "InRelease":
+		body, err := p.get(ctx, uri)
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		files, err := repodata.ParseRelease(body)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", uri, err)
+		}
+		return p.debianIndexes(dir, files), nil
+	}
+
+	if format, _ := repodata.Detect(uri); format == repodata.Unknown {
+		return nil, fmt.Errorf("%s: unsupported metadata file", uri)
+	}
+	return []string{uri}, nil
+}
+
+// debianIndexes selects one Packages file per directory from the files listed
+// in the Release file in dir. Directories of architectures not matching the
+// architecture filter are skipped.
+func (p *Prefetcher) debianIndexes(dir string, files []string) []string {
+	candidates := map[string]map[string]bool{}
+	var dirs []string
+	for _, file := range files {
+		uri := path.Join(dir, file)
+		if format, _ := repodata.Detect(uri); format != repodata.Debian {
+			continue
+		}
+		indexDir := path.Dir(uri)
+		if arch, ok := strings.CutPrefix(path.Base(indexDir), "binary-"); ok && arch != "all" && p.arch != nil && !p.arch.MatchString(arch) {
+			continue
+		}
+		if candidates[indexDir] == nil {
+			candidates[indexDir] = map[string]bool{}
+			dirs = append(dirs, indexDir)
+		}
+		candidates[indexDir][path.Base(uri)] = true
+	}
+
+	var indexes []string
+	for _, indexDir := range dirs {
+		for _, suffix := range debianPackagesSuffixes {
+			if candidates[indexDir]["Packages"+suffix] {
+				indexes = append(indexes, path.Join(indexDir, "Packages"+suffix))
+				break
+			}
+		}
+	}
+	return indexes
+}
+
+// packages returns the URIs of the packages listed in the index file at uri
+// which match the filters.
+func (p *Prefetcher) packages(ctx context.Context, uri string) ([]string, error) {
+	format, base := repodata.Detect(uri)
+	body, err := p.get(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	packages, err := repodata.ParsePackages(format, body)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("prefetch index", "uri", uri, "format", format, "packages", len(packages))
+
+	var uris []string
+	for _, pkg := range packages {
+		if p.name != nil && !p.name.MatchString(pkg.Name) {
+			continue
+		}
+		if p.arch != nil && !p.arch.MatchString(pkg.Arch) {
+			continue
+		}
+		uris = append(uris, path.Join(base, pkg.Location))
+	}
+	return uris, nil
+}
+
+// download fetches the file at uri through pkgproxy and discards it.
+func (p *Prefetcher) download(ctx context.Context, uri string) (int64, error) {
+	body, err := p.get(ctx, uri)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	return io.Copy(io.Discard, body)
+}
+
+// get requests uri from pkgproxy and returns the response body. Responses
+// other than 200 are returned as error.
+func (p *Prefetcher) get(ctx context.Context, uri string) (io.ReadCloser, error) {
+	u := *p.base
+	u.Path = path.Join("/", u.Path, uri)
+	u.RawPath = ""
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	rsp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		_ = rsp.Body.Close()
+		return nil, errors.New(rsp.Status)
+	}
+	return rsp.Body, nil
+}
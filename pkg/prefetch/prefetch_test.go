@@ -0,0 +1,111 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package prefetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer serves the given files and records the requested paths.
+func newTestServer(t *testing.T, files map[string]string) (*httptest.Server, *[]string) {
+	t.Helper()
+	var mu sync.Mutex
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		content, ok := files[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(content))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requested
+}
+
+func TestRunRPM(t *testing.T) {
+	server, requested := newTestServer(t, map[string]string{
+		"/fedora/os/repodata/repomd.xml": `<repomd><data type="primary"><location href="repodata/abcd-primary.xml"/></data></repomd>`,
+		"/fedora/os/repodata/abcd-primary.xml": `<metadata>
+<package><name>bash</name><arch>x86_64</arch><location href="Packages/b/bash.rpm"/></package>
+<package><name>bash-doc</name><arch>noarch</arch><location href="Packages/b/bash-doc.rpm"/></package>
+<package><name>gcc-c++</name><arch>x86_64</arch><location href="Packages/g/gcc-c++.rpm"/></package>
+<package><name>zsh</name><arch>i686</arch><location href="Packages/z/zsh.rpm"/></package>
+</metadata>`,
+		"/fedora/os/Packages/b/bash.rpm":     "bash",
+		"/fedora/os/Packages/b/bash-doc.rpm": "bash-doc",
+		"/fedora/os/Packages/g/gcc-c++.rpm":  "gcc",
+	})
+
+	p, err := New(&Config{URL: server.URL, Concurrency: 2, Arch: regexp.MustCompile("^(x86_64|noarch)$")})
+	require.NoError(t, err)
+	result, err := p.Run(context.Background(), "/fedora/os/repodata/repomd.xml")
+	require.NoError(t, err)
+	assert.Equal(t, &Result{Packages: 3, Fetched: 3, Size: int64(len("bash") + len("bash-doc") + len("gcc"))}, result)
+	assert.NotContains(t, *requested, "/fedora/os/Packages/z/zsh.rpm")
+
+	p, err = New(&Config{URL: server.URL, Name: regexp.MustCompile("^bash$")})
+	require.NoError(t, err)
+	result, err = p.Run(context.Background(), "/fedora/os/repodata/abcd-primary.xml")
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Packages)
+}
+
+func TestRunDebian(t *testing.T) {
+	server, requested := newTestServer(t, map[string]string{
+		"/debian/dists/bookworm/Release": `Codename: bookworm
+SHA256:
+ 0000 10 main/binary-amd64/Packages
+ 0000 10 main/binary-amd64/Packages.gz
+ 0000 10 main/binary-arm64/Packages
+ 0000 10 main/i18n/Translation-en
+`,
+		// compressed files are detected by content, plain text is accepted
+		"/debian/dists/bookworm/main/binary-amd64/Packages.gz": `Package: bash
+Architecture: amd64
+Filename: pool/main/b/bash/bash_5.2_amd64.deb
+
+Package: missing
+Architecture: all
+Filename: pool/main/m/missing/missing_1.0_all.deb
+`,
+		"/debian/pool/main/b/bash/bash_5.2_amd64.deb": "bash",
+	})
+
+	p, err := New(&Config{URL: server.URL + "/", Arch: regexp.MustCompile("^(amd64|all)$")})
+	require.NoError(t, err)
+	result, err := p.Run(context.Background(), "/debian/dists/bookworm/Release")
+	require.NoError(t, err)
+	assert.Equal(t, &Result{Packages: 2, Fetched: 1, Failed: 1, Size: int64(len("bash"))}, result)
+	assert.NotContains(t, *requested, "/debian/dists/bookworm/main/binary-amd64/Packages", "the compressed file is preferred")
+	assert.NotContains(t, *requested, "/debian/dists/bookworm/main/binary-arm64/Packages")
+}
+
+func TestRunErrors(t *testing.T) {
+	server, _ := newTestServer(t, map[string]string{
+		"/fedora/os/repodata/repomd.xml": `<repomd></repomd>`,
+	})
+	p, err := New(&Config{URL: server.URL})
+	require.NoError(t, err)
+
+	_, err = p.Run(context.Background(), "/fedora/os/repodata/repomd.xml")
+	assert.ErrorContains(t, err, "no primary metadata")
+	_, err = p.Run(context.Background(), "/fedora/os/repodata/abcd-primary.xml")
+	assert.ErrorContains(t, err, "404")
+	_, err = p.Run(context.Background(), "/fedora/os/Packages/b/bash.rpm")
+	assert.ErrorContains(t, err, "unsupported metadata file")
+
+	_, err = New(&Config{URL: "localhost:8080"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,116 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package repodata
+
+import (
+	"bufio"
+	"encoding/xml"
+	"io"
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// MetalinkFile is a file listed in a metalink document.
+type MetalinkFile struct {
+	// File name without directory
+	Name string
+	// SHA-256 checksum of the file, empty if not listed
+	SHA256 string
+	// http and https URLs of the file, most preferred first
+	URLs []string
+}
+
+// ParseMetalink reads a Metalink 3.0 document (as served by Fedora's
+// MirrorManager) or a Metalink 4.0 document (RFC 5854) from r. The URLs of
+// each file are ordered by their preference (3.0) or priority (4.0). URLs with
+// the same rank keep the order of the document, which usually reflects the
+// location of the requesting client.
+func ParseMetalink(r io.Reader) ([]MetalinkFile, error) {
+	type metalinkHash struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:",chardata"`
+	}
+	type metalinkURL struct {
+		Preference *int   `xml:"preference,attr"`
+		Priority   *int   `xml:"priority,attr"`
+		Value      string `xml:",chardata"`
+	}
+	type metalinkFile struct {
+		Name string `xml:"name,attr"`
+		// Metalink 3.0
+		Verification []metalinkHash `xml:"verification>hash"`
+		Resources    []metalinkURL  `xml:"resources>url"`
+		// Metalink 4.0
+		Hashes []metalinkHash `xml:"hash"`
+		URLs   []metalinkURL  `xml:"url"`
+	}
+	var doc struct {
+		Files  []metalinkFile `xml:"files>file"`
+		Files4 []metalinkFile `xml:"file"`
+	}
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	var files []MetalinkFile
+	for _, f := range append(doc.Files, doc.Files4...) {
+		file := MetalinkFile{Name: f.Name}
+		for _, h := range append(f.Verification, f.Hashes...) {
+			if t := strings.ToLower(h.Type); t == "sha256" || t == "sha-256" {
+				file.SHA256 = strings.ToLower(strings.TrimSpace(h.Value))
+			}
+		}
+
+		// lower rank is preferred
+		type rankedURL struct {
+			url  string
+			rank int
+		}
+		var urls []rankedURL
+		for _, u := range append(f.Resources, f.URLs...) {
+			value := strings.TrimSpace(u.Value)
+			if !isHTTPURL(value) {
+				continue
+			}
+			rank := math.MaxInt
+			switch {
+			case u.Preference != nil:
+				rank = -*u.Preference
+			case u.Priority != nil:
+				rank = *u.Priority
+			}
+			urls = append(urls, rankedURL{url: value, rank: rank})
+		}
+		sort.SliceStable(urls, func(i, j int) bool {
+			return urls[i].rank < urls[j].rank
+		})
+		for _, u := range urls {
+			file.URLs = append(file.URLs, u.url)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// ParseMirrorlist reads a plain mirror list with one URL per line (as served
+// by the mirror lists of CentOS or Rocky Linux) from r. Empty lines, comments
+// and URLs with other schemes than http and https are skipped.
+func ParseMirrorlist(r io.Reader) ([]string, error) {
+	var urls []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || !isHTTPURL(line) {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	return urls, scanner.Err()
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,87 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package repodata
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMetalink3(t *testing.T) {
+	metalink := `<?xml version="1.0" encoding="utf-8"?>
+<metalink version="3.0" xmlns="http://www.metalinker.org/" xmlns:mm0="http://fedorahosted.org/mirrormanager">
+ <files>
+  <file name="repomd.xml">
+   <mm0:timestamp>1745000000</mm0:timestamp>
+   <size>7000</size>
+   <verification>
+    <hash type="md5">0123</hash>
+    <hash type="sha256">` + strings.ToUpper(sumA) + `</hash>
+   </verification>
+   <resources maxconnections="1">
+    <url protocol="rsync" type="rsync" location="DE" preference="100">rsync://mirror1.example.com/fedora/linux/releases/42/Everything/x86_64/os/repodata/repomd.xml</url>
+    <url protocol="https" type="https" location="CH" preference="99">https://mirror2.example.com/fedora/linux/releases/42/Everything/x86_64/os/repodata/repomd.xml</url>
+    <url protocol="https" type="https" location="DE" preference="100">https://mirror1.example.com/fedora/linux/releases/42/Everything/x86_64/os/repodata/repomd.xml</url>
+    <url protocol="http" type="http" location="DE" preference="100">http://mirror3.example.com/pub/fedora/linux/releases/42/Everything/x86_64/os/repodata/repomd.xml</url>
+   </resources>
+  </file>
+ </files>
+</metalink>`
+
+	files, err := ParseMetalink(strings.NewReader(metalink))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "repomd.xml", files[0].Name)
+	assert.Equal(t, sumA, files[0].SHA256)
+	assert.Equal(t, []string{
+		"https://mirror1.example.com/fedora/linux/releases/42/Everything/x86_64/os/repodata/repomd.xml",
+		"http://mirror3.example.com/pub/fedora/linux/releases/42/Everything/x86_64/os/repodata/repomd.xml",
+		"https://mirror2.example.com/fedora/linux/releases/42/Everything/x86_64/os/repodata/repomd.xml",
+	}, files[0].URLs)
+}
+
+func TestParseMetalink4(t *testing.T) {
+	metalink := `<?xml version="1.0" encoding="UTF-8"?>
+<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+  <file name="repomd.xml">
+    <size>7000</size>
+    <hash type="sha-256">` + sumB + `</hash>
+    <url location="de">https://mirror3.example.com/os/repodata/repomd.xml</url>
+    <url location="ch" priority="2">https://mirror2.example.com/os/repodata/repomd.xml</url>
+    <url location="de" priority="1">https://mirror1.example.com/os/repodata/repomd.xml</url>
+  </file>
+</metalink>`
+
+	files, err := ParseMetalink(strings.NewReader(metalink))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, sumB, files[0].SHA256)
+	assert.Equal(t, []string{
+		"https://mirror1.example.com/os/repodata/repomd.xml",
+		"https://mirror2.example.com/os/repodata/repomd.xml",
+		"https://mirror3.example.com/os/repodata/repomd.xml",
+	}, files[0].URLs)
+}
+
+func TestParseMetalinkInvalid(t *testing.T) {
+	_, err := ParseMetalink(strings.NewReader("<metalink><files>"))
+	assert.Error(t, err)
+}
+
+func TestParseMirrorlist(t *testing.T) {
+	mirrorlist := `# repo = baseos arch = x86_64 country = CH
+https://mirror1.example.com/rocky/9.5/BaseOS/x86_64/os/
+
+http://mirror2.example.com/rocky/9.5/BaseOS/x86_64/os/
+ftp://mirror3.example.com/rocky/9.5/BaseOS/x86_64/os/
+`
+	urls, err := ParseMirrorlist(strings.NewReader(mirrorlist))
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"https://mirror1.example.com/rocky/9.5/BaseOS/x86_64/os/",
+		"http://mirror2.example.com/rocky/9.5/BaseOS/x86_64/os/",
+	}, urls)
+}
@@ -0,0 +1,58 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package repodata
+
+import (
+	"bufio"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// ParseRepomd reads the repomd.xml of a RPM repository from r and returns the
+// locations of the listed metadata files by their type (e.g. "primary"),
+// relative to the directory containing the "repodata" directory.
+func ParseRepomd(r io.Reader) (map[string]string, error) {
+	var doc struct {
+		Data []struct {
+			Type     string `xml:"type,attr"`
+			Location struct {
+				Href string `xml:"href,attr"`
+			} `xml:"location"`
+		} `xml:"data"`
+	}
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	locations := map[string]string{}
+	for _, data := range doc.Data {
+		if data.Type != "" && data.Location.Href != "" {
+			locations[data.Type] = data.Location.Href
+		}
+	}
+	return locations, nil
+}
+
+// ParseRelease reads the Release or InRelease file of a Debian distribution
+// from r and returns the files listed in its SHA256 section, relative to the
+// directory of the Release file.
+func ParseRelease(r io.Reader) ([]string, error) {
+	var files []string
+	inSHA256 := false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, " ") {
+			inSHA256 = strings.TrimSpace(line) == "SHA256:"
+			continue
+		}
+		if !inSHA256 {
+			continue
+		}
+		// <checksum> <size> <path>
+		if fields := strings.Fields(line); len(fields) == 3 {
+			files = append(files, fields[2])
+		}
+	}
+	return files, scanner.Err()
+}
@@ -0,0 +1,50 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package repodata
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRepomd(t *testing.T) {
+	repomd := `<?xml version="1.0" encoding="UTF-8"?>
+<repomd xmlns="http://linux.duke.edu/metadata/repo">
+  <revision>1712345678</revision>
+  <data type="primary">
+    <checksum type="sha256">` + sumA + `</checksum>
+    <location href="repodata/` + sumA + `-primary.xml.zst"/>
+  </data>
+  <data type="filelists">
+    <location href="repodata/` + sumB + `-filelists.xml.zst"/>
+  </data>
+</repomd>`
+
+	locations, err := ParseRepomd(strings.NewReader(repomd))
+	require.NoError(t, err)
+	assert.Equal(t, "repodata/"+sumA+"-primary.xml.zst", locations["primary"])
+	assert.Equal(t, "repodata/"+sumB+"-filelists.xml.zst", locations["filelists"])
+
+	_, err = ParseRepomd(strings.NewReader("<repomd>"))
+	assert.Error(t, err)
+}
+
+func TestParseRelease(t *testing.T) {
+	release := `Origin: Debian
+Suite: stable
+Codename: bookworm
+MD5Sum:
+ 0123456789abcdef0123456789abcdef 1234 main/binary-amd64/Packages.md5
+SHA256:
+ ` + sumA + ` 1234 main/binary-amd64/Packages
+ ` + sumB + `  567 main/binary-amd64/Packages.xz
+-----BEGIN PGP SIGNATURE-----
+`
+
+	files, err := ParseRelease(strings.NewReader(release))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"main/binary-amd64/Packages", "main/binary-amd64/Packages.xz"}, files)
+}
@@ -0,0 +1,282 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+
+// Package repodata extracts the packages and checksums published in the
+// metadata of RPM, Debian and Arch Linux repositories and parses the metalink
+// and mirror list documents used to discover their mirrors.
+package repodata
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Format identifies the type of a repository index file.
+type Format int
+
+const (
+	// Unknown is returned for files that don't contain package checksums
+	Unknown Format = iota
+	// RPM is the primary.xml of a RPM repository
+	RPM
+	// Debian is a Packages file of a Debian repository
+	Debian
+	// Arch is the package database of an Arch Linux repository
+	Arch
+)
+
+func (f Format) String() string {
+	switch f {
+	case RPM:
+		return "rpm"
+	case Debian:
+		return "debian"
+	case Arch:
+		return "arch"
+	default:
+		return "unknown"
+	}
+}
+
+var (
+	rpmPrimaryRegexp  = regexp.MustCompile(`^([0-9a-f]+-)?primary\.xml(\.(gz|bz2|xz|zst))?$`)
+	debPackagesRegexp = regexp.MustCompile(`^Packages(\.(gz|bz2|xz))?$`)
+	archDBRegexp      = regexp.MustCompile(`\.db(\.tar(\.(gz|bz2|xz|zst))?)?$`)
+)
+
+// Detect returns the format of the index file at uri and the base URI that
+// the package locations listed in the index are relative to.
+func Detect(uri string) (Format, string) {
+	uri = strings.SplitN(uri, "?", 2)[0]
+	dir, name := path.Split(uri)
+	dir = strings.TrimSuffix(dir, "/")
+
+	switch {
+	case rpmPrimaryRegexp.MatchString(name) && path.Base(dir) == "repodata":
+		return RPM, path.Dir(dir)
+	case debPackagesRegexp.MatchString(name) && strings.Contains(dir, "/dists/"):
+		return Debian, dir[:strings.Index(dir, "/dists/")]
+	case archDBRegexp.MatchString(name):
+		return Arch, dir
+	}
+	return Unknown, ""
+}
+
+// Package is a package listed in a repository index file.
+type Package struct {
+	Name string
+	Arch string
+	// Location of the package relative to the base URI returned by Detect
+	Location string
+	// SHA-256 checksum of the package, empty if not listed
+	SHA256 string
+}
+
+// Parse reads the index file in the given format from r and returns the
+// SHA-256 checksums of the listed packages by their location relative to the
+// base URI returned by Detect. Compressed files are decompressed
+// transparently.
+func Parse(format Format, r io.Reader) (map[string]string, error) {
+	packages, err := ParsePackages(format, r)
+	if err != nil {
+		return nil, err
+	}
+	checksums := map[string]string{}
+	for _, pkg := range packages {
+		if pkg.SHA256 != "" {
+			checksums[pkg.Location] = pkg.SHA256
+		}
+	}
+	return checksums, nil
+}
+
+// ParsePackages reads the index file in the given format from r and returns
+// the packages it lists. Compressed files are decompressed transparently.
+func ParsePackages(format Format, r io.Reader) ([]Package, error) {
+	r, err := decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case RPM:
+		return parsePrimary(r)
+	case Debian:
+		return parsePackages(r)
+	case Arch:
+		return parseArchDB(r)
+	default:
+		return nil, fmt.Errorf("unsupported repository index format: %s", format)
+	}
+}
+
+// decompress sniffs the compression format from the first bytes of r.
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(6)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		d, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	case bytes.HasPrefix(magic, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		return xz.NewReader(br)
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return bzip2.NewReader(br), nil
+	default:
+		return br, nil
+	}
+}
+
+// parsePrimary parses the package list of a RPM repository.
+func parsePrimary(r io.Reader) ([]Package, error) {
+	type rpmPackage struct {
+		Name     string `xml:"name"`
+		Arch     string `xml:"arch"`
+		Checksum struct {
+			Type  string `xml:"type,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"checksum"`
+		Location struct {
+			Href string `xml:"href,attr"`
+			Base string `xml:"base,attr"`
+		} `xml:"location"`
+	}
+
+	var packages []Package
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return packages, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "package" {
+			continue
+		}
+		var pkg rpmPackage
+		if err := decoder.DecodeElement(&pkg, &start); err != nil {
+			return nil, err
+		}
+		// packages hosted elsewhere are not served from this repository
+		if pkg.Location.Href == "" || pkg.Location.Base != "" {
+			continue
+		}
+		p := Package{Name: pkg.Name, Arch: pkg.Arch, Location: pkg.Location.Href}
+		if pkg.Checksum.Type == "sha256" {
+			p.SHA256 = strings.ToLower(strings.TrimSpace(pkg.Checksum.Value))
+		}
+		packages = append(packages, p)
+	}
+}
+
+// parsePackages parses the stanzas of a Debian Packages file.
+func parsePackages(r io.Reader) ([]Package, error) {
+	var packages []Package
+	var pkg Package
+	flush := func() {
+		if pkg.Location != "" {
+			pkg.SHA256 = strings.ToLower(pkg.SHA256)
+			packages = append(packages, pkg)
+		}
+		pkg = Package{}
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, "Package:"); ok {
+			pkg.Name = strings.TrimSpace(value)
+		} else if value, ok := strings.CutPrefix(line, "Architecture:"); ok {
+			pkg.Arch = strings.TrimSpace(value)
+		} else if value, ok := strings.CutPrefix(line, "Filename:"); ok {
+			pkg.Location = strings.TrimSpace(value)
+		} else if value, ok := strings.CutPrefix(line, "SHA256:"); ok {
+			pkg.SHA256 = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return packages, nil
+}
+
+// parseArchDB parses the desc files in the tar archive of an Arch Linux
+// package database.
+func parseArchDB(r io.Reader) ([]Package, error) {
+	var packages []Package
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return packages, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if path.Base(hdr.Name) != "desc" {
+			continue
+		}
+		fields, err := parseDesc(tr)
+		if err != nil {
+			return nil, err
+		}
+		if fields["FILENAME"] != "" {
+			packages = append(packages, Package{
+				Name:     fields["NAME"],
+				Arch:     fields["ARCH"],
+				Location: fields["FILENAME"],
+				SHA256:   strings.ToLower(fields["SHA256SUM"]),
+			})
+		}
+	}
+}
+
+// parseDesc returns the first value of each %FIELD% in a desc file.
+func parseDesc(r io.Reader) (map[string]string, error) {
+	fields := map[string]string{}
+	var field string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			field = ""
+		case strings.HasPrefix(line, "%") && strings.HasSuffix(line, "%") && len(line) > 2:
+			field = strings.Trim(line, "%")
+		case field != "":
+			if _, ok := fields[field]; !ok {
+				fields[field] = line
+			}
+		}
+	}
+	return fields, scanner.Err()
+}
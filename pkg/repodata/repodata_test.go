@@ -0,0 +1,164 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package repodata
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ulikunitz/xz"
+)
+
+const (
+	sumA = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	sumB = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		uri    string
+		format Format
+		base   string
+	}{
+		{"/fedora/releases/42/Everything/x86_64/os/repodata/0123abcd-primary.xml.zst", RPM, "/fedora/releases/42/Everything/x86_64/os"},
+		{"/epel/9/Everything/x86_64/repodata/primary.xml.gz", RPM, "/epel/9/Everything/x86_64"},
+		{"/fedora/releases/42/Everything/x86_64/os/repodata/repomd.xml", Unknown, ""},
+		{"/fedora/primary.xml.gz", Unknown, ""},
+		{"/debian/dists/bookworm/main/binary-amd64/Packages.xz", Debian, "/debian"},
+		{"/debian/dists/bookworm/main/binary-amd64/Packages", Debian, "/debian"},
+		{"/debian/dists/bookworm/main/i18n/Translation-en.xz", Unknown, ""},
+		{"/archlinux/core/os/x86_64/core.db", Arch, "/archlinux/core/os/x86_64"},
+		{"/archlinux/core/os/x86_64/core.db.tar.gz", Arch, "/archlinux/core/os/x86_64"},
+		{"/archlinux/core/os/x86_64/core.db.sig", Unknown, ""},
+		{"/archlinux/core/os/x86_64/core.files", Unknown, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			format, base := Detect(tt.uri)
+			assert.Equal(t, tt.format, format)
+			assert.Equal(t, tt.base, base)
+		})
+	}
+}
+
+func TestParsePrimary(t *testing.T) {
+	primary := `<?xml version="1.0" encoding="UTF-8"?>
+<metadata xmlns="http://linux.duke.edu/metadata/common" packages="3">
+<package type="rpm">
+  <name>bash</name>
+  <checksum type="sha256" pkgid="YES">` + sumA + `</checksum>
+  <location href="Packages/b/bash-5.2.rpm"/>
+</package>
+<package type="rpm">
+  <name>old</name>
+  <checksum type="sha1" pkgid="YES">0123</checksum>
+  <location href="Packages/o/old-1.0.rpm"/>
+</package>
+<package type="rpm">
+  <name>remote</name>
+  <checksum type="sha256" pkgid="YES">` + sumB + `</checksum>
+  <location xml:base="https://example.com/" href="Packages/r/remote-1.0.rpm"/>
+</package>
+</metadata>`
+
+	var buf bytes.Buffer
+	zw, err := zstd.NewWriter(&buf)
+	require.NoError(t, err)
+	_, err = zw.Write([]byte(primary))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	checksums, err := Parse(RPM, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"Packages/b/bash-5.2.rpm": sumA}, checksums)
+}
+
+func TestParsePackages(t *testing.T) {
+	packages := `Package: bash
+Version: 5.2
+Filename: pool/main/b/bash/bash_5.2_amd64.deb
+SHA256: ` + sumA + `
+
+Package: nosum
+Filename: pool/main/n/nosum/nosum_1.0_amd64.deb
+
+Package: zsh
+Filename: pool/main/z/zsh/zsh_5.9_amd64.deb
+SHA256: ` + sumB + `
+`
+
+	var buf bytes.Buffer
+	xw, err := xz.NewWriter(&buf)
+	require.NoError(t, err)
+	_, err = xw.Write([]byte(packages))
+	require.NoError(t, err)
+	require.NoError(t, xw.Close())
+
+	checksums, err := Parse(Debian, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"pool/main/b/bash/bash_5.2_amd64.deb": sumA,
+		"pool/main/z/zsh/zsh_5.9_amd64.deb":   sumB,
+	}, checksums)
+}
+
+func TestParseArchDB(t *testing.T) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	files := map[string]string{
+		"bash-5.2-1/desc":  "%FILENAME%\nbash-5.2-1-x86_64.pkg.tar.zst\n\n%NAME%\nbash\n\n%SHA256SUM%\n" + sumA + "\n",
+		"bash-5.2-1/files": "%FILES%\nusr/bin/bash\n",
+	}
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+
+	checksums, err := Parse(Arch, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"bash-5.2-1-x86_64.pkg.tar.zst": sumA}, checksums)
+}
+
+func TestParsePackagesNameAndArch(t *testing.T) {
+	primary := `<metadata>
+<package type="rpm">
+  <name>bash</name>
+  <arch>x86_64</arch>
+  <checksum type="sha256" pkgid="YES">` + sumA + `</checksum>
+  <location href="Packages/b/bash-5.2.rpm"/>
+</package>
+<package type="rpm">
+  <name>old</name>
+  <arch>noarch</arch>
+  <checksum type="sha1" pkgid="YES">0123</checksum>
+  <location href="Packages/o/old-1.0.rpm"/>
+</package>
+</metadata>`
+	packages, err := ParsePackages(RPM, bytes.NewReader([]byte(primary)))
+	require.NoError(t, err)
+	assert.Equal(t, []Package{
+		{Name: "bash", Arch: "x86_64", Location: "Packages/b/bash-5.2.rpm", SHA256: sumA},
+		{Name: "old", Arch: "noarch", Location: "Packages/o/old-1.0.rpm"},
+	}, packages)
+
+	debian := "Package: bash\nArchitecture: amd64\nFilename: pool/main/b/bash/bash_5.2_amd64.deb\n"
+	packages, err = ParsePackages(Debian, bytes.NewReader([]byte(debian)))
+	require.NoError(t, err)
+	assert.Equal(t, []Package{{Name: "bash", Arch: "amd64", Location: "pool/main/b/bash/bash_5.2_amd64.deb"}}, packages)
+}
+
+func TestParseInvalid(t *testing.T) {
+	_, err := Parse(RPM, bytes.NewReader([]byte("<metadata><package>")))
+	assert.Error(t, err)
+	_, err = Parse(Unknown, bytes.NewReader(nil))
+	assert.Error(t, err)
+}
@@ -0,0 +1,94 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package repodata
+
+import (
+	"path"
+	"sync"
+	"time"
+)
+
+// Store keeps the package checksums extracted from repository index files in
+// memory, keyed by the request URI of the package. A package can be listed by
+// several index files (e.g. the Packages files of different suites sharing a
+// pool), so the store counts how many of them provide each URI.
+type Store struct {
+	mu        sync.RWMutex
+	checksums map[string]string
+	refs      map[string]int
+	sources   map[string]*source
+}
+
+// source is an index file whose checksums were added to the store.
+type source struct {
+	modTime time.Time
+	uris    []string
+}
+
+// NewStore returns an empty checksum store.
+func NewStore() *Store {
+	return &Store{
+		checksums: map[string]string{},
+		refs:      map[string]int{},
+		sources:   map[string]*source{},
+	}
+}
+
+// Lookup returns the SHA-256 checksum of the package at uri, if known.
+func (s *Store) Lookup(uri string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sum, ok := s.checksums[uri]
+	return sum, ok
+}
+
+// Claim reports whether the index file at uri with the given modification
+// time still has to be added to the store. Only the first caller for a given
+// version of the file gets true.
+func (s *Store) Claim(uri string, modTime time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	src, ok := s.sources[uri]
+	if !ok {
+		src = &source{}
+		s.sources[uri] = src
+	} else if src.modTime.Equal(modTime) {
+		return false
+	}
+	src.modTime = modTime
+	return true
+}
+
+// Update replaces the checksums previously added from the index file at uri
+// with the given checksums. The keys are package locations relative to base.
+// A checksum is only removed once no index file provides its URI anymore.
+func (s *Store) Update(uri string, base string, checksums map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	src, ok := s.sources[uri]
+	if !ok {
+		src = &source{}
+		s.sources[uri] = src
+	}
+	for _, u := range src.uris {
+		s.refs[u]--
+		if s.refs[u] <= 0 {
+			delete(s.refs, u)
+			delete(s.checksums, u)
+		}
+	}
+	src.uris = make([]string, 0, len(checksums))
+	for location, sum := range checksums {
+		u := path.Join(base, location)
+		s.checksums[u] = sum
+		s.refs[u]++
+		src.uris = append(src.uris, u)
+	}
+}
+
+// Len returns the number of known package checksums.
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.checksums)
+}
@@ -0,0 +1,61 @@
+// Copyright 2026 Reto Gantenbein
+// SPDX-License-Identifier: Apache-2.0
+package repodata
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoreUpdateReplacesSource(t *testing.T) {
+	s := NewStore()
+	s.Update("/repo/dists/stable/main/binary-amd64/Packages.xz", "/repo", map[string]string{
+		"pool/a.deb": sumA,
+		"pool/b.deb": sumB,
+	})
+	sum, ok := s.Lookup("/repo/pool/a.deb")
+	assert.True(t, ok)
+	assert.Equal(t, sumA, sum)
+	assert.Equal(t, 2, s.Len())
+
+	s.Update("/repo/dists/stable/main/binary-amd64/Packages.xz", "/repo", map[string]string{
+		"pool/b.deb": sumA,
+	})
+	_, ok = s.Lookup("/repo/pool/a.deb")
+	assert.False(t, ok, "checksums dropped from the index must be removed")
+	sum, _ = s.Lookup("/repo/pool/b.deb")
+	assert.Equal(t, sumA, sum)
+}
+
+func TestStoreUpdateKeepsSharedChecksums(t *testing.T) {
+	s := NewStore()
+	s.Update("/repo/dists/stable/main/binary-amd64/Packages.xz", "/repo", map[string]string{
+		"pool/a.deb": sumA,
+		"pool/b.deb": sumB,
+	})
+	s.Update("/repo/dists/testing/main/binary-amd64/Packages.xz", "/repo", map[string]string{
+		"pool/a.deb": sumA,
+	})
+
+	s.Update("/repo/dists/stable/main/binary-amd64/Packages.xz", "/repo", map[string]string{
+		"pool/b.deb": sumB,
+	})
+	sum, ok := s.Lookup("/repo/pool/a.deb")
+	assert.True(t, ok, "checksums still provided by another index must be kept")
+	assert.Equal(t, sumA, sum)
+
+	s.Update("/repo/dists/testing/main/binary-amd64/Packages.xz", "/repo", map[string]string{})
+	_, ok = s.Lookup("/repo/pool/a.deb")
+	assert.False(t, ok, "checksums no longer provided by any index must be removed")
+	assert.Equal(t, 1, s.Len())
+}
+
+func TestStoreClaim(t *testing.T) {
+	s := NewStore()
+	modTime := time.Now()
+	assert.True(t, s.Claim("/repo/core.db", modTime))
+	assert.False(t, s.Claim("/repo/core.db", modTime))
+	assert.True(t, s.Claim("/repo/core.db", modTime.Add(time.Minute)))
+}